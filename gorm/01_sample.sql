@@ -1 +0,0 @@
-create database myshop
@@ -1 +0,0 @@
-create schema if not exists online_shop;
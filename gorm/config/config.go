@@ -2,6 +2,8 @@ package config
 
 import (
 	"log"
+	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -9,19 +11,81 @@ import (
 type Config struct {
 	Database DatabaseConfig
 	Server   ServerConfig
+	Tax      TaxConfig
+
+	Idempotency IdempotencyConfig
+	Outbox      OutboxConfig
+	Report      ReportConfig
+	Tracing     TracingConfig
+	Auth        AuthConfig
 }
 
 type DatabaseConfig struct {
+	Driver   string // postgres または sqlite
+	Path     string // SQLiteのファイル(:memory:ならメモリ上)
 	Host     string
 	Port     string
 	User     string
 	Password string
 	DBName   string
 	SSLMode  string
+	Schema   string // search_pathに設定するスキーマ(空ならDBのデフォルト)
+
+	RequireMigrated bool // 未適用のマイグレーションがあればサーバを起動しない
+
+	ReplicaDSNs []string // リードレプリカの接続文字列(空ならプライマリだけを使う)
+
+	// 接続プールの設定(リードレプリカにも同じ値を使う)
+	MaxOpenConns    int           // 同時に開く接続の上限
+	MaxIdleConns    int           // 使っていない接続を残しておく数
+	ConnMaxLifetime time.Duration // 1つの接続を使い続ける期間
+	ConnMaxIdleTime time.Duration // 使っていない接続を閉じるまでの時間
 }
 
 type ServerConfig struct {
 	Port string
+
+	BatchMaxOrders int // POST /orders:batch で1回に受け付ける最大件数
+
+	// リクエストの処理(DBのクエリ)を打ち切るまでの時間。過ぎると504を返す
+	RequestTimeout time.Duration // 下記以外のAPI
+	BulkTimeout    time.Duration // バッチ・CSV取り込み
+	ExportTimeout  time.Duration // エクスポート
+	ReportTimeout  time.Duration // 集計
+
+	ShutdownTimeout time.Duration // 終了のシグナルを受けてから処理中のリクエストを待つ時間
+	ReadyTimeout    time.Duration // /readyzでDBを確認するときの上限
+}
+
+type TaxConfig struct {
+	Rounding string // 消費税の端数処理(floor/ceil/half_up)
+}
+
+type OutboxConfig struct {
+	RabbitMQURL  string        // 空ならrelayを起動しない
+	Exchange     string        // 注文のメッセージを送るtopic exchange
+	PollInterval time.Duration // 未送信のメッセージを確認する間隔
+	BatchSize    int           // 1回に送る最大件数
+}
+
+type ReportConfig struct {
+	TimeZone string // 集計の期間を区切るタイムゾーン
+	Currency string // 集計を換算する通貨(空なら通貨ごとに集計する)
+}
+
+type TracingConfig struct {
+	Exporter    string  // トレースの送信先(none/otlp/stdout/file)
+	File        string  // Exporterがfileの場合の出力先
+	ServiceName string  // トレースに記録するサービス名
+	SampleRatio float64 // 記録するリクエストの割合(呼び出し元が記録したものは必ず記録する)
+}
+
+type AuthConfig struct {
+	JWTSecret string // jwt-authと同じJWT_SECRET(アクセストークンの検証に使う。サーバの起動に必須)
+}
+
+type IdempotencyConfig struct {
+	KeyTTL time.Duration // Idempotency-Keyの有効期限
 }
 
 func LoadConfig() *Config {
@@ -39,21 +103,146 @@ func LoadConfig() *Config {
 
 	cfg := &Config{
 		Database: DatabaseConfig{
+			Driver:   viper.GetString("DB_DRIVER"),
+			Path:     viper.GetString("DB_PATH"),
 			Host:     viper.GetString("DB_HOST"),
 			Port:     viper.GetString("DB_PORT"),
 			User:     viper.GetString("DB_USER"),
 			Password: viper.GetString("DB_PASSWORD"),
 			DBName:   viper.GetString("DB_NAME"),
 			SSLMode:  viper.GetString("DB_SSLMODE"),
+			Schema:   viper.GetString("DB_SCHEMA"),
+
+			RequireMigrated: viper.GetBool("DB_REQUIRE_MIGRATED"),
+
+			ReplicaDSNs: splitList(viper.GetString("DB_REPLICA_DSNS")),
+
+			MaxOpenConns:    viper.GetInt("DB_MAX_OPEN_CONNS"),
+			MaxIdleConns:    viper.GetInt("DB_MAX_IDLE_CONNS"),
+			ConnMaxLifetime: viper.GetDuration("DB_CONN_MAX_LIFETIME"),
+			ConnMaxIdleTime: viper.GetDuration("DB_CONN_MAX_IDLE_TIME"),
 		},
 		Server: ServerConfig{
 			Port: viper.GetString("SERVER_PORT"),
+
+			BatchMaxOrders: viper.GetInt("BATCH_MAX_ORDERS"),
+
+			RequestTimeout: viper.GetDuration("REQUEST_TIMEOUT"),
+			BulkTimeout:    viper.GetDuration("BULK_TIMEOUT"),
+			ExportTimeout:  viper.GetDuration("EXPORT_TIMEOUT"),
+			ReportTimeout:  viper.GetDuration("REPORT_TIMEOUT"),
+
+			ShutdownTimeout: viper.GetDuration("SHUTDOWN_TIMEOUT"),
+			ReadyTimeout:    viper.GetDuration("READY_TIMEOUT"),
+		},
+		Tax: TaxConfig{
+			Rounding: viper.GetString("TAX_ROUNDING"),
+		},
+		Idempotency: IdempotencyConfig{
+			KeyTTL: viper.GetDuration("IDEMPOTENCY_KEY_TTL"),
+		},
+		Outbox: OutboxConfig{
+			RabbitMQURL:  viper.GetString("RABBITMQ_URL"),
+			Exchange:     viper.GetString("OUTBOX_EXCHANGE"),
+			PollInterval: viper.GetDuration("OUTBOX_POLL_INTERVAL"),
+			BatchSize:    viper.GetInt("OUTBOX_BATCH_SIZE"),
+		},
+		Report: ReportConfig{
+			TimeZone: viper.GetString("REPORT_TIMEZONE"),
+			Currency: viper.GetString("REPORT_CURRENCY"),
 		},
+		Tracing: TracingConfig{
+			Exporter:    viper.GetString("TRACING_EXPORTER"),
+			File:        viper.GetString("TRACING_FILE"),
+			ServiceName: viper.GetString("OTEL_SERVICE_NAME"),
+			SampleRatio: viper.GetFloat64("TRACING_SAMPLE_RATIO"),
+		},
+		Auth: AuthConfig{
+			JWTSecret: viper.GetString("JWT_SECRET"),
+		},
+	}
+
+	if cfg.Database.Driver == "" {
+		cfg.Database.Driver = "postgres"
+	}
+	if cfg.Database.Path == "" {
+		cfg.Database.Path = ":memory:"
+	}
+	if cfg.Database.MaxOpenConns <= 0 {
+		cfg.Database.MaxOpenConns = 20
+	}
+	if cfg.Database.MaxIdleConns <= 0 {
+		cfg.Database.MaxIdleConns = 10
+	}
+	if cfg.Database.ConnMaxLifetime <= 0 {
+		cfg.Database.ConnMaxLifetime = 30 * time.Minute
+	}
+	if cfg.Database.ConnMaxIdleTime <= 0 {
+		cfg.Database.ConnMaxIdleTime = 5 * time.Minute
+	}
+	if cfg.Server.BatchMaxOrders <= 0 {
+		cfg.Server.BatchMaxOrders = 1000
+	}
+	if cfg.Server.RequestTimeout <= 0 {
+		cfg.Server.RequestTimeout = 10 * time.Second
+	}
+	if cfg.Server.BulkTimeout <= 0 {
+		cfg.Server.BulkTimeout = 2 * time.Minute
+	}
+	if cfg.Server.ExportTimeout <= 0 {
+		cfg.Server.ExportTimeout = 10 * time.Minute
+	}
+	if cfg.Server.ReportTimeout <= 0 {
+		cfg.Server.ReportTimeout = time.Minute
+	}
+	if cfg.Server.ShutdownTimeout <= 0 {
+		cfg.Server.ShutdownTimeout = 30 * time.Second
+	}
+	if cfg.Server.ReadyTimeout <= 0 {
+		cfg.Server.ReadyTimeout = 2 * time.Second
+	}
+	if cfg.Idempotency.KeyTTL <= 0 {
+		cfg.Idempotency.KeyTTL = 24 * time.Hour
+	}
+	if cfg.Outbox.Exchange == "" {
+		cfg.Outbox.Exchange = "orders"
+	}
+	if cfg.Outbox.PollInterval <= 0 {
+		cfg.Outbox.PollInterval = time.Second
+	}
+	if cfg.Outbox.BatchSize <= 0 {
+		cfg.Outbox.BatchSize = 100
+	}
+	if cfg.Report.TimeZone == "" {
+		cfg.Report.TimeZone = "Asia/Tokyo"
+	}
+	if cfg.Tracing.Exporter == "" {
+		cfg.Tracing.Exporter = "none"
+	}
+	if cfg.Tracing.File == "" {
+		cfg.Tracing.File = "traces.jsonl"
+	}
+	if cfg.Tracing.ServiceName == "" {
+		cfg.Tracing.ServiceName = "order-service"
+	}
+	if cfg.Tracing.SampleRatio <= 0 {
+		cfg.Tracing.SampleRatio = 1
 	}
 
-	if cfg.Database.Password == "" {
+	if cfg.Database.Driver == "postgres" && cfg.Database.Password == "" {
 		log.Fatal("DB_PASSWORD is required")
 	}
 
 	return cfg
 }
+
+// カンマ区切りの値を分割する(空の要素は無視する)
+func splitList(s string) []string {
+	var list []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
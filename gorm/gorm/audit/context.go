@@ -0,0 +1,37 @@
+package audit
+
+import "context"
+
+// 操作者が分からない場合のactor
+const AnonymousActor = "anonymous"
+
+type contextKey int
+
+const (
+	actorKey contextKey = iota
+	requestIDKey
+)
+
+// WithActor 操作者をcontextに設定する
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey, actor)
+}
+
+// ActorFrom contextの操作者(未設定ならAnonymousActor)
+func ActorFrom(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorKey).(string); ok && actor != "" {
+		return actor
+	}
+	return AnonymousActor
+}
+
+// WithRequestID リクエストIDをcontextに設定する
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey, requestID)
+}
+
+// RequestIDFrom contextのリクエストID(未設定なら空文字)
+func RequestIDFrom(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey).(string)
+	return requestID
+}
@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// RoleAdmin 管理者のロール(全ユーザーの注文を扱える)
+const RoleAdmin = "admin"
+
+// jwt-authのアクセストークンのtoken_type(リフレッシュトークンは受け付けない)
+const tokenTypeAccess = "access"
+
+// トークンが無効(署名・有効期限・種類のいずれかが不正)
+var ErrInvalidToken = errors.New("invalid token")
+
+// Claims jwt-authが発行するトークンのクレーム(jwt-authのutil.JWTClaimsと同じ形)
+type Claims struct {
+	UserID    uint   `json:"user_id"`
+	Email     string `json:"email"`
+	Username  string `json:"username"`
+	Role      string `json:"role,omitempty"`
+	TokenType string `json:"token_type"`
+	jwt.RegisteredClaims
+}
+
+// IsAdmin 管理者か
+func (c *Claims) IsAdmin() bool {
+	return c.Role == RoleAdmin
+}
+
+// Actor 変更履歴に記録する操作者(ユーザーID)
+func (c *Claims) Actor() string {
+	return strconv.FormatUint(uint64(c.UserID), 10)
+}
+
+// Verifier jwt-authと共有したシークレット(HS256)でアクセストークンを検証する
+type Verifier struct {
+	secret []byte
+	parser *jwt.Parser
+}
+
+func NewVerifier(secret string) (*Verifier, error) {
+	if secret == "" {
+		return nil, errors.New("JWT secret is empty")
+	}
+	return &Verifier{
+		secret: []byte(secret),
+		parser: jwt.NewParser(jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired()),
+	}, nil
+}
+
+// Verify トークンを検証してクレームを返す(無効ならErrInvalidToken)
+func (v *Verifier) Verify(token string) (*Claims, error) {
+	var claims Claims
+	_, err := v.parser.ParseWithClaims(token, &claims, func(*jwt.Token) (any, error) {
+		return v.secret, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if claims.TokenType != tokenTypeAccess {
+		return nil, fmt.Errorf("%w: not an access token", ErrInvalidToken)
+	}
+	if claims.UserID == 0 {
+		return nil, fmt.Errorf("%w: user_id is missing", ErrInvalidToken)
+	}
+	return &claims, nil
+}
+
+type claimsKey struct{}
+
+// WithClaims 認証したユーザーのクレームをcontextに設定する
+func WithClaims(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+// ClaimsFrom contextのクレーム(認証していなければfalse)
+func ClaimsFrom(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(*Claims)
+	return claims, ok
+}
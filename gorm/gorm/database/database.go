@@ -0,0 +1,133 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	gormConfig "github.com/makoto-developer/golang_examples/gorm/config"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+)
+
+// Driver DB_DRIVERごとの接続方法
+type Driver struct {
+	// DatabaseConfigからgormのDialectorを作る
+	Dialector func(cfg gormConfig.DatabaseConfig) gorm.Dialector
+	// 接続後の準備(nilなら何もしない)
+	Setup func(db *gorm.DB, cfg gormConfig.DatabaseConfig) error
+	// スキーマをmigration/sqlのSQLで管理するか(falseならSetupで作る)
+	SQLMigrations bool
+	// リードレプリカのDSNからDialectorを作る(nilならリードレプリカに対応しない)
+	ReplicaDialector func(dsn string) gorm.Dialector
+}
+
+var drivers = map[string]Driver{}
+
+// Register ドライバを登録する(各ドライバのinitから呼ぶ)
+func Register(name string, driver Driver) {
+	if _, ok := drivers[name]; ok {
+		panic("database: driver registered twice: " + name)
+	}
+	drivers[name] = driver
+}
+
+// Lookup 登録済みのドライバを取得する
+func Lookup(name string) (Driver, error) {
+	driver, ok := drivers[name]
+	if !ok {
+		names := make([]string, 0, len(drivers))
+		for n := range drivers {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return Driver{}, fmt.Errorf("unsupported DB_DRIVER: %s (use %s)", name, strings.Join(names, " or "))
+	}
+	return driver, nil
+}
+
+// Open cfg.Driverのドライバで接続して、ドライバの準備(Setup)まで行う。
+// DB_REPLICA_DSNSを指定した場合、トランザクション外の読み込みはリードレプリカで実行する
+func Open(cfg gormConfig.DatabaseConfig, gormCfg *gorm.Config) (*gorm.DB, error) {
+	driver, err := Lookup(cfg.Driver)
+	if err != nil {
+		return nil, err
+	}
+
+	// 日時のカラムはタイムゾーン無し(PostgreSQLはtimestamp、SQLiteは文字列)なので、
+	// サーバのタイムゾーンに関係なくUTCで保存する(集計や期間の絞り込みはUTCの前提)
+	if gormCfg.NowFunc == nil {
+		gormCfg.NowFunc = func() time.Time { return time.Now().UTC() }
+	}
+
+	db, err := gorm.Open(driver.Dialector(cfg), gormCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	configurePool(sqlDB, cfg)
+
+	if driver.Setup != nil {
+		if err := driver.Setup(db, cfg); err != nil {
+			return nil, fmt.Errorf("failed to set up %s: %w", cfg.Driver, err)
+		}
+	}
+
+	// Setupでのテーブル作成などはプライマリで行うので、リードレプリカはその後に設定する
+	if len(cfg.ReplicaDSNs) > 0 {
+		if err := useReplicas(db, driver, cfg); err != nil {
+			return nil, err
+		}
+	}
+	return db, nil
+}
+
+// 接続プールの上限と接続を使い回す期間を設定する
+func configurePool(sqlDB *sql.DB, cfg gormConfig.DatabaseConfig) {
+	sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+}
+
+// Pools プライマリ("primary")とリードレプリカ("replica1", "replica2", ...)の接続プール
+func Pools(db *gorm.DB) (map[string]*sql.DB, error) {
+	primary, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	pools := map[string]*sql.DB{"primary": primary}
+	if plugin, ok := db.Config.Plugins[resolverName]; ok {
+		_ = plugin.(*dbresolver.DBResolver).Call(func(pool gorm.ConnPool) error {
+			if sqlDB, ok := pool.(*sql.DB); ok && sqlDB != primary {
+				pools[fmt.Sprintf("replica%d", len(pools))] = sqlDB
+			}
+			return nil
+		})
+	}
+	return pools, nil
+}
+
+// Close プライマリとリードレプリカの接続プールを閉じる
+func Close(db *gorm.DB) error {
+	if plugin, ok := db.Config.Plugins[resolverName]; ok {
+		return plugin.(*dbresolver.DBResolver).Call(func(pool gorm.ConnPool) error {
+			if closer, ok := pool.(io.Closer); ok {
+				return closer.Close()
+			}
+			return nil
+		})
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
@@ -0,0 +1,34 @@
+package database
+
+import (
+	"fmt"
+
+	gormConfig "github.com/makoto-developer/golang_examples/gorm/config"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func init() {
+	Register("postgres", Driver{
+		Dialector:        postgresDialector,
+		SQLMigrations:    true,
+		ReplicaDialector: postgres.Open,
+	})
+}
+
+func postgresDialector(cfg gormConfig.DatabaseConfig) gorm.Dialector {
+	dsn := fmt.Sprintf(
+		// CURRENT_TIMESTAMPのデフォルト値もUTCにする
+		"host=%s user=%s password=%s dbname=%s port=%s sslmode=%s TimeZone=UTC",
+		cfg.Host,
+		cfg.User,
+		cfg.Password,
+		cfg.DBName,
+		cfg.Port,
+		cfg.SSLMode,
+	)
+	if cfg.Schema != "" {
+		dsn += " search_path=" + cfg.Schema
+	}
+	return postgres.Open(dsn)
+}
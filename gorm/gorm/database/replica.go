@@ -0,0 +1,76 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	gormConfig "github.com/makoto-developer/golang_examples/gorm/config"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+)
+
+// dbresolverのプラグイン名(gorm.Config.Pluginsのキー)
+var resolverName = (&dbresolver.DBResolver{}).Name()
+
+type primaryKey struct{}
+
+// WithPrimary ctxで実行する読み込みをリードレプリカではなくプライマリで実行する。
+// 書き込んだ直後に読み直す場合など、レプリカの遅延で古い値を読みたくないときに使う
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+// UsesPrimary ctxがWithPrimaryで作られたか
+func UsesPrimary(ctx context.Context) bool {
+	primary, _ := ctx.Value(primaryKey{}).(bool)
+	return primary
+}
+
+// 読み込み(トランザクション外のSELECT)をリードレプリカに振り分ける。
+// 書き込みとトランザクションはプライマリで実行する
+func useReplicas(db *gorm.DB, driver Driver, cfg gormConfig.DatabaseConfig) error {
+	if driver.ReplicaDialector == nil {
+		return fmt.Errorf("DB_DRIVER=%s does not support read replicas", cfg.Driver)
+	}
+
+	replicas := make([]gorm.Dialector, len(cfg.ReplicaDSNs))
+	for i, dsn := range cfg.ReplicaDSNs {
+		replicas[i] = driver.ReplicaDialector(dsn)
+	}
+	resolver := dbresolver.Register(dbresolver.Config{
+		Replicas: replicas,
+		Policy:   dbresolver.RoundRobinPolicy(),
+	})
+	if err := db.Use(resolver); err != nil {
+		return fmt.Errorf("failed to connect to read replicas: %w", err)
+	}
+	// リードレプリカの接続プールにもプライマリと同じ設定をする(プライマリはOpenで設定済み)
+	primary, err := db.DB()
+	if err != nil {
+		return err
+	}
+	_ = resolver.Call(func(pool gorm.ConnPool) error {
+		if sqlDB, ok := pool.(*sql.DB); ok && sqlDB != primary {
+			configurePool(sqlDB, cfg)
+		}
+		return nil
+	})
+
+	// WithPrimaryのctxで実行するクエリは、dbresolverが選んだ接続先をプライマリに選び直す
+	forcePrimary := func(tx *gorm.DB) {
+		if UsesPrimary(tx.Statement.Context) {
+			dbresolver.Write.ModifyStatement(tx.Statement)
+		}
+	}
+	for _, err := range []error{
+		db.Callback().Query().After(resolverName).Before("gorm:query").Register("app:force_primary", forcePrimary),
+		db.Callback().Row().After(resolverName).Before("gorm:row").Register("app:force_primary", forcePrimary),
+		db.Callback().Raw().After(resolverName).Before("gorm:raw").Register("app:force_primary", forcePrimary),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	gormConfig "github.com/makoto-developer/golang_examples/gorm/config"
+	"github.com/makoto-developer/golang_examples/gorm/gorm/model"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// DB_PATHにこれを指定するとメモリ上のDBを使う(サーバを止めると消える)
+const sqliteMemory = ":memory:"
+
+func init() {
+	Register("sqlite", Driver{
+		Dialector: sqliteDialector,
+		Setup:     setupSQLite,
+	})
+}
+
+func sqliteDialector(cfg gormConfig.DatabaseConfig) gorm.Dialector {
+	if cfg.Path == sqliteMemory {
+		return sqlite.Open(sqliteMemory)
+	}
+	// 同時に書き込んだときにすぐ"database is locked"にならないよう、
+	// 待ち時間を設定して、トランザクションの開始時に書き込みロックを取る
+	return sqlite.Open(cfg.Path + "?_busy_timeout=5000&_journal_mode=WAL&_txlock=immediate")
+}
+
+// SQLiteはmigration/sqlのSQL(PostgreSQL用)を使わず、モデルからテーブルを作る
+func setupSQLite(db *gorm.DB, cfg gormConfig.DatabaseConfig) error {
+	if cfg.Path == sqliteMemory {
+		// メモリ上のDBは接続ごとに別のDBになり、接続を閉じると消えるので、接続を1つにして閉じないようにする
+		sqlDB, err := db.DB()
+		if err != nil {
+			return err
+		}
+		sqlDB.SetMaxOpenConns(1)
+		sqlDB.SetMaxIdleConns(1)
+		sqlDB.SetConnMaxLifetime(0)
+		sqlDB.SetConnMaxIdleTime(0)
+	}
+
+	// 状態のカラムを追加する前からある注文は、0010_add_orders_status.up.sqlと同じく支払い済みにする
+	migrator := db.Migrator()
+	backfillStatus := migrator.HasTable(&model.Order{}) && !migrator.HasColumn(&model.Order{}, "Status")
+
+	// 明細グループの無い注文(order_item_group_id=0)があるので外部キーは作らない
+	db.Config.DisableForeignKeyConstraintWhenMigrating = true
+	if err := db.AutoMigrate(
+		&model.OrderItemGroup{},
+		&model.OrderItem{},
+		&model.Order{},
+		&model.TaxRate{},
+		&model.ExchangeRate{},
+		&model.IdempotencyKey{},
+		&model.OrderEvent{},
+		&model.OrderStatusTransition{},
+		&model.Refund{},
+		&model.OutboxMessage{},
+	); err != nil {
+		return err
+	}
+	if backfillStatus {
+		err := db.Unscoped().Model(&model.Order{}).
+			Where("1 = 1").
+			UpdateColumn("status", model.OrderStatusPaid).Error
+		if err != nil {
+			return fmt.Errorf("failed to backfill orders.status: %w", err)
+		}
+	}
+	return seedTaxRates(db)
+}
+
+// migration/sql/0003_create_tax_rates.up.sqlと同じ税率を、空のときだけ登録する
+func seedTaxRates(db *gorm.DB) error {
+	var count int64
+	if err := db.Model(&model.TaxRate{}).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	// 税率は日本時間の0時に切り替わったので、UTCの日時(前日の15時)にして登録する
+	jst := time.FixedZone("JST", 9*60*60)
+	date := func(year int, month time.Month, day int) *time.Time {
+		t := time.Date(year, month, day, 0, 0, 0, 0, jst).UTC()
+		return &t
+	}
+	rates := []model.TaxRate{
+		{Code: model.TaxRateCodeStandard, Name: "標準税率", Rate: 5, EffectiveFrom: *date(1997, 4, 1), EffectiveTo: date(2014, 4, 1)},
+		{Code: model.TaxRateCodeStandard, Name: "標準税率", Rate: 8, EffectiveFrom: *date(2014, 4, 1), EffectiveTo: date(2019, 10, 1)},
+		{Code: model.TaxRateCodeStandard, Name: "標準税率", Rate: 10, EffectiveFrom: *date(2019, 10, 1)},
+		{Code: model.TaxRateCodeReduced, Name: "軽減税率", Rate: 8, EffectiveFrom: *date(2019, 10, 1)},
+	}
+	return db.Create(&rates).Error
+}
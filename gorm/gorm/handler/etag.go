@@ -0,0 +1,30 @@
+package handler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/makoto-developer/golang_examples/gorm/gorm/model"
+)
+
+// 注文のETag(バージョンをそのまま使う)
+func orderETag(order *model.Order) string {
+	return fmt.Sprintf(`"%d"`, order.Version)
+}
+
+// If-Matchヘッダーのバージョン。ヘッダーが無いか"*"の場合はok=false
+func ifMatchVersion(c *gin.Context) (version int64, ok bool, err error) {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	if header == "" || header == "*" {
+		return 0, false, nil
+	}
+
+	tag := strings.TrimPrefix(header, "W/")
+	version, err = strconv.ParseInt(strings.Trim(tag, `"`), 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid If-Match: %s", header)
+	}
+	return version, true, nil
+}
@@ -0,0 +1,28 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/makoto-developer/golang_examples/gorm/gorm/repository"
+)
+
+type ExchangeRateHandler struct {
+	repo repository.ExchangeRateRepository
+}
+
+func NewExchangeRateHandler(repo repository.ExchangeRateRepository) *ExchangeRateHandler {
+	return &ExchangeRateHandler{
+		repo: repo,
+	}
+}
+
+func (h *ExchangeRateHandler) GetExchangeRates(c *gin.Context) {
+	rates, err := h.repo.List(c.Request.Context())
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, rates)
+}
@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/makoto-developer/golang_examples/gorm/gorm/database"
+	"github.com/makoto-developer/golang_examples/gorm/migration"
+	"gorm.io/gorm"
+)
+
+type HealthHandler struct {
+	db       *gorm.DB
+	migrator *migration.Migrator // nilならマイグレーションを確認しない(SQLiteなど)
+	timeout  time.Duration       // readyzの確認1回あたりの上限
+}
+
+func NewHealthHandler(db *gorm.DB, migrator *migration.Migrator, timeout time.Duration) *HealthHandler {
+	return &HealthHandler{
+		db:       db,
+		migrator: migrator,
+		timeout:  timeout,
+	}
+}
+
+type healthResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// Healthz プロセスが動いていれば200を返す(GET /healthz)。DBには接続しない
+func (h *HealthHandler) Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, healthResponse{Status: "ok"})
+}
+
+// Readyz DBに接続でき、未適用のマイグレーションが無ければ200、そうでなければ503を返す(GET /readyz)
+func (h *HealthHandler) Readyz(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), h.timeout)
+	defer cancel()
+
+	res := healthResponse{Status: "ok", Checks: map[string]string{}}
+	status := http.StatusOK
+	check := func(name string, err error) {
+		if err != nil {
+			res.Checks[name] = err.Error()
+			res.Status = "unavailable"
+			status = http.StatusServiceUnavailable
+			return
+		}
+		res.Checks[name] = "ok"
+	}
+
+	err := h.ping(ctx)
+	check("database", err)
+	// DBに接続できない場合はマイグレーションも確認できない
+	if h.migrator != nil && err == nil {
+		check("migrations", h.pendingMigrations(ctx))
+	}
+
+	c.JSON(status, res)
+}
+
+func (h *HealthHandler) ping(ctx context.Context) error {
+	sqlDB, err := h.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+func (h *HealthHandler) pendingMigrations(ctx context.Context) error {
+	pending, err := h.migrator.WithContext(database.WithPrimary(ctx)).Pending()
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("%d pending migration(s) (first: %d_%s)", len(pending), pending[0].Version, pending[0].Name)
+	}
+	return nil
+}
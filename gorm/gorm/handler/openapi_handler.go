@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gin-gonic/gin"
+	swaggerFiles "github.com/swaggo/files/v2"
+)
+
+// Swagger UIの設定(同梱のswagger-initializer.jsはサンプルのURLを読むので差し替える)
+const swaggerInitializer = `window.onload = function() {
+  window.ui = SwaggerUIBundle({
+    url: "/openapi.json",
+    dom_id: '#swagger-ui',
+    deepLinking: true,
+    presets: [SwaggerUIBundle.presets.apis, SwaggerUIStandalonePreset],
+    plugins: [SwaggerUIBundle.plugins.DownloadUrl],
+    layout: "StandaloneLayout"
+  });
+};
+`
+
+type OpenAPIHandler struct {
+	spec []byte // JSONにした仕様書
+	ui   http.Handler
+}
+
+func NewOpenAPIHandler(doc *openapi3.T) (*OpenAPIHandler, error) {
+	spec, err := doc.MarshalJSON()
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode openapi spec: %w", err)
+	}
+	return &OpenAPIHandler{
+		spec: spec,
+		ui:   http.StripPrefix("/docs", http.FileServerFS(swaggerFiles.FS)),
+	}, nil
+}
+
+// Spec 仕様書をJSONで返す(GET /openapi.json)
+func (h *OpenAPIHandler) Spec(c *gin.Context) {
+	c.Data(http.StatusOK, "application/json; charset=utf-8", h.spec)
+}
+
+// Docs 仕様書を表示するSwagger UIを返す(GET /docs/*filepath)
+func (h *OpenAPIHandler) Docs(c *gin.Context) {
+	if c.Param("filepath") == "/swagger-initializer.js" {
+		c.Data(http.StatusOK, "text/javascript; charset=utf-8", []byte(swaggerInitializer))
+		return
+	}
+	h.ui.ServeHTTP(c.Writer, c.Request)
+}
@@ -0,0 +1,228 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/makoto-developer/golang_examples/gorm/gorm/model"
+	"github.com/makoto-developer/golang_examples/gorm/gorm/problem"
+)
+
+// CreateInBatchesで1回にINSERTする件数
+const insertBatchSize = 100
+
+// バッチの実行方法
+type batchMode string
+
+const (
+	batchAllOrNothing batchMode = "all_or_nothing" // 1件でも失敗したら何も保存しない(デフォルト)
+	batchBestEffort   batchMode = "best_effort"    // 成功したものだけ保存する
+)
+
+// バッチのリクエスト。idを含む要素は更新(PUTと同じ)、含まない要素は作成(POSTと同じ)
+type batchOrdersRequest struct {
+	Mode   batchMode         `json:"mode"`
+	Orders []json.RawMessage `json:"orders"`
+}
+
+// 要素ごとの結果(indexはリクエストのordersの位置)
+type batchResult struct {
+	Index  int          `json:"index"`
+	Status int          `json:"status"`
+	ID     int64        `json:"id,omitempty"`
+	Order  *model.Order `json:"order,omitempty"`
+	Error  string       `json:"error,omitempty"`
+	Code   string       `json:"code,omitempty"` // problem+jsonのcodeと同じ
+}
+
+type batchOrdersResponse struct {
+	Mode      batchMode     `json:"mode"`
+	Succeeded int           `json:"succeeded"`
+	Failed    int           `json:"failed"`
+	Results   []batchResult `json:"results"`
+}
+
+// 検証済みの要素
+type batchEntry struct {
+	index  int
+	order  *model.Order
+	update bool
+}
+
+// BatchOrders 複数の注文をまとめて作成・更新する(POST /orders:batch)
+func (h *OrderHandler) BatchOrders(c *gin.Context) {
+	var req batchOrdersRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(problem.BadRequest(fmt.Sprintf("Invalid request body: %v", err)))
+		return
+	}
+
+	if req.Mode == "" {
+		req.Mode = batchAllOrNothing
+	}
+	if req.Mode != batchAllOrNothing && req.Mode != batchBestEffort {
+		_ = c.Error(problem.BadRequest(fmt.Sprintf("unsupported mode: %s", req.Mode)))
+		return
+	}
+	if len(req.Orders) == 0 {
+		_ = c.Error(problem.BadRequest("orders is required"))
+		return
+	}
+	if len(req.Orders) > h.batchMaxSize {
+		_ = c.Error(problem.New(http.StatusRequestEntityTooLarge, problem.CodePayloadTooLarge,
+			fmt.Sprintf("too many orders: %d (max %d)", len(req.Orders), h.batchMaxSize)))
+		return
+	}
+
+	results := make([]batchResult, len(req.Orders))
+	var entries []batchEntry
+	for i, raw := range req.Orders {
+		results[i].Index = i
+		entry, err := h.prepareBatchEntry(c.Request.Context(), raw)
+		if err != nil {
+			setErrorResult(&results[i], err)
+			continue
+		}
+		entry.index = i
+		entries = append(entries, entry)
+	}
+	if err := c.Request.Context().Err(); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	failed := len(req.Orders) - len(entries)
+	if req.Mode == batchAllOrNothing && failed > 0 {
+		skipEntries(results, entries, "not saved because another order failed")
+		c.JSON(http.StatusUnprocessableEntity, newBatchResponse(req.Mode, results))
+		return
+	}
+
+	// ロールバックされてもID・バージョンなどは書き換わっているので、1件ずつやり直す用に複製しておく
+	pristine := cloneEntries(entries)
+	if err := h.saveEntries(c, entries); err != nil {
+		if req.Mode == batchAllOrNothing {
+			p := problem.From(err)
+			skipEntries(results, entries, p.Detail)
+			c.JSON(p.Status, newBatchResponse(req.Mode, results))
+			return
+		}
+		// まとめて保存できなかった場合は1件ずつ保存して、失敗したものを特定する
+		for _, entry := range pristine {
+			err := h.saveEntries(c, []batchEntry{entry})
+			setEntryResult(&results[entry.index], entry, err)
+		}
+		c.JSON(http.StatusOK, newBatchResponse(req.Mode, results))
+		return
+	}
+
+	for _, entry := range entries {
+		setEntryResult(&results[entry.index], entry, nil)
+	}
+	c.JSON(http.StatusOK, newBatchResponse(req.Mode, results))
+}
+
+// 要素を作成・更新の注文にして検証する
+func (h *OrderHandler) prepareBatchEntry(ctx context.Context, raw json.RawMessage) (batchEntry, error) {
+	var head struct {
+		ID int64 `json:"id"`
+	}
+	if err := json.Unmarshal(raw, &head); err != nil {
+		return batchEntry{}, problem.BadRequest(fmt.Sprintf("Invalid request body: %v", err))
+	}
+
+	if head.ID == 0 {
+		var req createOrderRequest
+		if err := json.Unmarshal(raw, &req); err != nil {
+			return batchEntry{}, problem.BadRequest(fmt.Sprintf("Invalid request body: %v", err))
+		}
+		order := req.Order
+		if err := h.prepareCreate(ctx, &order, req.Items); err != nil {
+			return batchEntry{}, err
+		}
+		return batchEntry{order: &order}, nil
+	}
+
+	order, err := h.repo.Get(ctx, uint64(head.ID))
+	if err != nil {
+		return batchEntry{}, err
+	}
+	decode := func(obj any) error {
+		return json.NewDecoder(bytes.NewReader(raw)).Decode(obj)
+	}
+	if err := h.prepareUpdate(ctx, order, decode); err != nil {
+		return batchEntry{}, err
+	}
+	return batchEntry{order: order, update: true}, nil
+}
+
+func (h *OrderHandler) saveEntries(c *gin.Context, entries []batchEntry) error {
+	var creates, updates []*model.Order
+	for _, entry := range entries {
+		if entry.update {
+			updates = append(updates, entry.order)
+		} else {
+			creates = append(creates, entry.order)
+		}
+	}
+	return h.repo.SaveBatch(c.Request.Context(), creates, updates, insertBatchSize)
+}
+
+func setEntryResult(result *batchResult, entry batchEntry, err error) {
+	if err != nil {
+		setErrorResult(result, err)
+		return
+	}
+	result.Status = http.StatusCreated
+	if entry.update {
+		result.Status = http.StatusOK
+	}
+	result.ID = entry.order.ID
+	result.Order = entry.order
+}
+
+func cloneEntries(entries []batchEntry) []batchEntry {
+	clones := make([]batchEntry, len(entries))
+	for i, entry := range entries {
+		order := *entry.order
+		if order.OrderItemGroup != nil {
+			group := *order.OrderItemGroup
+			group.Items = append([]model.OrderItem(nil), group.Items...)
+			order.OrderItemGroup = &group
+		}
+		clones[i] = batchEntry{index: entry.index, order: &order, update: entry.update}
+	}
+	return clones
+}
+
+// 検証は通ったが保存しなかった要素に理由を設定する
+func skipEntries(results []batchResult, entries []batchEntry, reason string) {
+	for _, entry := range entries {
+		results[entry.index].Status = http.StatusFailedDependency
+		results[entry.index].Error = reason
+	}
+}
+
+// 失敗した要素のステータスとcodeは単体のAPIと同じ対応にする
+func setErrorResult(result *batchResult, err error) {
+	p := problem.From(err)
+	result.Status = p.Status
+	result.Code = p.Code
+	result.Error = p.Detail
+}
+
+func newBatchResponse(mode batchMode, results []batchResult) batchOrdersResponse {
+	res := batchOrdersResponse{Mode: mode, Results: results}
+	for _, r := range results {
+		if r.Error == "" {
+			res.Succeeded++
+		} else {
+			res.Failed++
+		}
+	}
+	return res
+}
@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/makoto-developer/golang_examples/gorm/gorm/model"
+	"github.com/makoto-developer/golang_examples/gorm/gorm/problem"
+	"github.com/makoto-developer/golang_examples/gorm/gorm/repository"
+)
+
+type OrderEventHandler struct {
+	repo repository.OrderEventRepository
+}
+
+func NewOrderEventHandler(repo repository.OrderEventRepository) *OrderEventHandler {
+	return &OrderEventHandler{
+		repo: repo,
+	}
+}
+
+// 注文の変更履歴。stateは履歴の最後の時点(atを指定した場合はその時点)の注文
+type orderHistoryResponse struct {
+	OrderID int64               `json:"order_id"`
+	Events  []*model.OrderEvent `json:"events"`
+	State   model.JSON          `json:"state"`
+}
+
+func (h *OrderEventHandler) GetOrderHistory(c *gin.Context) {
+	id := c.Param("id")
+	orderID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		_ = c.Error(problem.BadRequest("Invalid order ID"))
+		return
+	}
+
+	at, err := parseTimeQuery(c, "at", false)
+	if err != nil {
+		_ = c.Error(problem.BadRequest(err.Error()))
+		return
+	}
+
+	events, err := h.repo.ListByOrderID(c.Request.Context(), orderID, at)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	if len(events) == 0 {
+		_ = c.Error(problem.NotFound("Order history not found"))
+		return
+	}
+
+	c.JSON(http.StatusOK, orderHistoryResponse{
+		OrderID: int64(orderID),
+		Events:  events,
+		State:   events[len(events)-1].After,
+	})
+}
@@ -0,0 +1,139 @@
+package handler
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/makoto-developer/golang_examples/gorm/gorm/model"
+	"github.com/makoto-developer/golang_examples/gorm/gorm/ordercsv"
+	"github.com/makoto-developer/golang_examples/gorm/gorm/problem"
+	"github.com/makoto-developer/golang_examples/gorm/gorm/repository"
+)
+
+// 何行ごとにクライアントへ送り出すか
+const exportFlushEvery = 500
+
+// ExportOrders 注文を絞り込み条件でCSVかNDJSONにして返す(GET /orders/export)
+func (h *OrderHandler) ExportOrders(c *gin.Context) {
+	filter, err := parseOrderFilter(c)
+	if err != nil {
+		_ = c.Error(problem.BadRequest(err.Error()))
+		return
+	}
+
+	h.exportOrders(c, filter, "orders")
+}
+
+// ExportOrdersByUserID ユーザーの注文をCSVかNDJSONにして返す(GET /users/:user_id/orders/export)
+func (h *OrderHandler) ExportOrdersByUserID(c *gin.Context) {
+	userID := c.Param("user_id")
+	uid, err := strconv.ParseUint(userID, 10, 64)
+	if err != nil {
+		_ = c.Error(problem.BadRequest("Invalid user ID"))
+		return
+	}
+	if err := checkUserAccess(c, uid); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	filter, err := parseOrderFilter(c)
+	if err != nil {
+		_ = c.Error(problem.BadRequest(err.Error()))
+		return
+	}
+	filter.UserID = uid
+
+	h.exportOrders(c, filter, fmt.Sprintf("user_%d_orders", uid))
+}
+
+// DBのカーソルから読んだ注文を1行ずつレスポンスに書き出す。
+// ステータスとヘッダーは最初の行を読めてから(0件なら読み終わってから)送るので、
+// クエリが失敗した場合はエラーのレスポンスを返せる
+func (h *OrderHandler) exportOrders(c *gin.Context, filter repository.OrderFilter, name string) {
+	format := c.DefaultQuery("format", "csv")
+
+	var contentType string
+	var begin func() error
+	var write func(order *model.Order) error
+	var flush func() error
+	switch format {
+	case "csv":
+		contentType = "text/csv; charset=utf-8"
+		w := csv.NewWriter(c.Writer)
+		// ヘッダー行はデータが無くても出力する
+		begin = func() error {
+			return w.Write(ordercsv.Header)
+		}
+		write = func(order *model.Order) error {
+			return w.Write(ordercsv.Record(order))
+		}
+		flush = func() error {
+			w.Flush()
+			return w.Error()
+		}
+	case "ndjson":
+		contentType = "application/x-ndjson"
+		enc := json.NewEncoder(c.Writer)
+		begin = func() error { return nil }
+		write = func(order *model.Order) error {
+			return enc.Encode(order)
+		}
+		flush = func() error { return nil }
+	default:
+		_ = c.Error(problem.BadRequest(fmt.Sprintf("unsupported format: %s (use csv or ndjson)", format)))
+		return
+	}
+
+	started := false
+	start := func() error {
+		if started {
+			return nil
+		}
+		started = true
+		filename := fmt.Sprintf("%s_%s.%s", name, time.Now().Format("20060102150405"), format)
+		c.Header("Content-Type", contentType)
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+		c.Status(http.StatusOK)
+		return begin()
+	}
+
+	count := 0
+	err := h.repo.Export(c.Request.Context(), filter, func(order *model.Order) error {
+		if err := start(); err != nil {
+			return err
+		}
+		if err := write(order); err != nil {
+			return err
+		}
+		count++
+		if count%exportFlushEvery == 0 {
+			if err := flush(); err != nil {
+				return err
+			}
+			c.Writer.Flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = start()
+	}
+	if err == nil {
+		err = flush()
+	}
+	if err == nil {
+		return
+	}
+	if started {
+		// ステータスは送信済みなので、途中で切れたことはログにだけ残す
+		log.Printf("Export interrupted after %d rows: %v", count, err)
+	}
+	// まだ何も送っていなければ、problemのミドルウェアがエラーのレスポンスを返す
+	_ = c.Error(err)
+}
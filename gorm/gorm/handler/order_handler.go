@@ -1,23 +1,36 @@
 package handler
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/makoto-developer/golang_examples/gorm/gorm/auth"
 	"github.com/makoto-developer/golang_examples/gorm/gorm/model"
+	"github.com/makoto-developer/golang_examples/gorm/gorm/problem"
 	"github.com/makoto-developer/golang_examples/gorm/gorm/repository"
+	"github.com/makoto-developer/golang_examples/gorm/gorm/tax"
+	"gorm.io/gorm"
 )
 
 type OrderHandler struct {
-	repo repository.OrderRepository
+	repo         repository.OrderRepository
+	taxRates     repository.TaxRateRepository
+	calc         *tax.Calculator
+	batchMaxSize int
 }
 
-func NewOrderHandler(repo repository.OrderRepository) *OrderHandler {
+func NewOrderHandler(repo repository.OrderRepository, taxRates repository.TaxRateRepository, calc *tax.Calculator, batchMaxSize int) *OrderHandler {
 	return &OrderHandler{
-		repo: repo,
+		repo:         repo,
+		taxRates:     taxRates,
+		calc:         calc,
+		batchMaxSize: batchMaxSize,
 	}
 }
 
@@ -25,9 +38,7 @@ func (h *OrderHandler) GetOrders(c *gin.Context) {
 	ids := c.Query("ids")
 
 	if ids == "" {
-		c.JSON(http.StatusOK, gin.H{
-			"message": "Use ?ids=1,2,3 to get specific orders",
-		})
+		h.listOrders(c)
 		return
 	}
 
@@ -37,43 +48,64 @@ func (h *OrderHandler) GetOrders(c *gin.Context) {
 	for _, idStr := range idStrings {
 		id, err := strconv.ParseUint(strings.TrimSpace(idStr), 10, 64)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error": fmt.Sprintf("Invalid ID format: %s", idStr),
-			})
+			_ = c.Error(problem.BadRequest(fmt.Sprintf("Invalid ID format: %s", idStr)))
 			return
 		}
 		orderIDs = append(orderIDs, id)
 	}
 
-	orders, err := h.repo.ListByOrderID(orderIDs)
+	orders, err := h.repo.ListByOrderID(c.Request.Context(), orderIDs)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": err.Error(),
-		})
+		_ = c.Error(err)
 		return
 	}
 
 	c.JSON(http.StatusOK, orders)
 }
 
+// 絞り込み条件とカーソルで注文一覧を返す
+func (h *OrderHandler) listOrders(c *gin.Context) {
+	filter, err := parseOrderFilter(c)
+	if err != nil {
+		_ = c.Error(problem.BadRequest(err.Error()))
+		return
+	}
+
+	page, err := parsePage(c)
+	if err != nil {
+		_ = c.Error(problem.BadRequest(err.Error()))
+		return
+	}
+
+	result, err := h.repo.List(c.Request.Context(), filter, page)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
 func (h *OrderHandler) GetOrder(c *gin.Context) {
 	id := c.Param("id")
 	orderID, err := strconv.ParseUint(id, 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Invalid order ID",
-		})
+		_ = c.Error(problem.BadRequest("Invalid order ID"))
 		return
 	}
 
-	order := h.repo.Get(orderID)
-	if order == nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": "Order not found",
-		})
+	var order *model.Order
+	if c.Query("expand") == "items" {
+		order, err = h.repo.GetWithItems(c.Request.Context(), orderID)
+	} else {
+		order, err = h.repo.Get(c.Request.Context(), orderID)
+	}
+	if err != nil {
+		_ = c.Error(err)
 		return
 	}
 
+	c.Header("ETag", orderETag(order))
 	c.JSON(http.StatusOK, order)
 }
 
@@ -81,47 +113,49 @@ func (h *OrderHandler) GetOrdersByUserID(c *gin.Context) {
 	userID := c.Param("user_id")
 	uid, err := strconv.ParseUint(userID, 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Invalid user ID",
-		})
+		_ = c.Error(problem.BadRequest("Invalid user ID"))
+		return
+	}
+	if err := checkUserAccess(c, uid); err != nil {
+		_ = c.Error(err)
 		return
 	}
 
-	orders, err := h.repo.ListByUserID(uid)
+	orders, err := h.repo.ListByUserID(c.Request.Context(), uid)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": err.Error(),
-		})
+		_ = c.Error(err)
 		return
 	}
 
 	c.JSON(http.StatusOK, orders)
 }
 
+// 注文作成のリクエスト。itemsを指定すると明細グループも一緒に作成する
+type createOrderRequest struct {
+	model.Order
+	Items []model.OrderItem `json:"items"`
+}
+
 func (h *OrderHandler) CreateOrder(c *gin.Context) {
-	var order model.Order
+	var req createOrderRequest
 
-	if err := c.ShouldBindJSON(&order); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": fmt.Sprintf("Invalid request body: %v", err),
-		})
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(problem.BadRequest(fmt.Sprintf("Invalid request body: %v", err)))
 		return
 	}
 
-	if err := h.validateOrder(&order); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": err.Error(),
-		})
+	order := req.Order
+	if err := h.prepareCreate(c.Request.Context(), &order, req.Items); err != nil {
+		_ = c.Error(err)
 		return
 	}
 
-	if err := h.repo.Create(order); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": err.Error(),
-		})
+	if err := h.repo.Create(c.Request.Context(), &order); err != nil {
+		_ = c.Error(err)
 		return
 	}
 
+	c.Header("ETag", orderETag(&order))
 	c.JSON(http.StatusCreated, order)
 }
 
@@ -129,41 +163,43 @@ func (h *OrderHandler) UpdateOrder(c *gin.Context) {
 	id := c.Param("id")
 	orderID, err := strconv.ParseUint(id, 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Invalid order ID",
-		})
+		_ = c.Error(problem.BadRequest("Invalid order ID"))
+		return
+	}
+
+	expectedVersion, hasIfMatch, err := ifMatchVersion(c)
+	if err != nil {
+		_ = c.Error(problem.BadRequest(err.Error()))
 		return
 	}
 
-	order := h.repo.Get(orderID)
-	if order == nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": "Order not found",
-		})
+	order, err := h.repo.Get(c.Request.Context(), orderID)
+	if err != nil {
+		_ = c.Error(err)
 		return
 	}
 
-	if err := c.ShouldBindJSON(&order); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": fmt.Sprintf("Invalid request body: %v", err),
-		})
+	if hasIfMatch && expectedVersion != order.Version {
+		c.Header("ETag", orderETag(order))
+		_ = c.Error(problem.New(http.StatusPreconditionFailed, problem.CodePreconditionFailed,
+			"Order has been modified (If-Match does not match)"))
 		return
 	}
 
-	if err := h.validateOrder(order); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": err.Error(),
-		})
+	if err := h.prepareUpdate(c.Request.Context(), order, c.ShouldBindJSON); err != nil {
+		_ = c.Error(err)
 		return
 	}
+	if hasIfMatch {
+		order.Version = expectedVersion
+	}
 
-	if err := h.repo.Update(*order); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": err.Error(),
-		})
+	if err := h.repo.Update(c.Request.Context(), order); err != nil {
+		_ = c.Error(err)
 		return
 	}
 
+	c.Header("ETag", orderETag(order))
 	c.JSON(http.StatusOK, order)
 }
 
@@ -171,39 +207,294 @@ func (h *OrderHandler) DeleteOrder(c *gin.Context) {
 	id := c.Param("id")
 	orderID, err := strconv.ParseUint(id, 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Invalid order ID",
-		})
+		_ = c.Error(problem.BadRequest("Invalid order ID"))
+		return
+	}
+
+	reason, err := deleteReason(c)
+	if err != nil {
+		_ = c.Error(err)
 		return
 	}
 
-	if err := h.repo.Delete(orderID); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": err.Error(),
-		})
+	if err := h.repo.Delete(c.Request.Context(), orderID, reason); err != nil {
+		_ = c.Error(err)
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"message": "Order deleted successfully",
+		"message":     "Order deleted successfully",
+		"why_deleted": reason,
 	})
 }
 
+// 削除・状態遷移の理由のリクエスト
+type reasonRequest struct {
+	Reason string `json:"reason"`
+}
+
+// 理由をボディ({"reason": "..."})かクエリパラメータ(?reason=)から取得する(無ければ空)
+func requestReason(c *gin.Context) (string, error) {
+	reason := c.Query("reason")
+	if reason == "" && c.Request.ContentLength != 0 {
+		var req reasonRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			return "", problem.BadRequest(fmt.Sprintf("Invalid request body: %v", err))
+		}
+		reason = req.Reason
+	}
+	return strings.TrimSpace(reason), nil
+}
+
+// 削除理由(必須)
+func deleteReason(c *gin.Context) (string, error) {
+	reason, err := requestReason(c)
+	if err != nil {
+		return "", err
+	}
+	if reason == "" {
+		return "", repository.Invalid("reason", "is required")
+	}
+	return reason, nil
+}
+
+func (h *OrderHandler) RestoreOrder(c *gin.Context) {
+	id := c.Param("id")
+	orderID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		_ = c.Error(problem.BadRequest("Invalid order ID"))
+		return
+	}
+
+	order, err := h.repo.Restore(c.Request.Context(), orderID)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.Header("ETag", orderETag(order))
+	c.JSON(http.StatusOK, order)
+}
+
+// 新規注文の金額を計算して検証する(POSTとバッチ作成で共通)。
+// 注文者はトークンのユーザーにする(ボディのuser_idは使わない)。状態は支払い待ちから始める
+func (h *OrderHandler) prepareCreate(ctx context.Context, order *model.Order, items []model.OrderItem) error {
+	// 作成日時は税率と集計の基準なので、ボディのidやcreated_atなどは使わずに保存時の値にする
+	order.ID, order.CreatedAt, order.UpdatedAt, order.DeletedAt, order.WhyDeleted = 0, time.Time{}, time.Time{}, gorm.DeletedAt{}, ""
+	if claims, ok := auth.ClaimsFrom(ctx); ok {
+		order.UserID = int64(claims.UserID)
+	}
+	order.Status = model.OrderStatusPending
+	order.RefundedAmount, order.RefundedTax = model.Money{}, model.Money{}
+	if err := h.applyTotals(ctx, order, items, time.Now()); err != nil {
+		return err
+	}
+	return h.validateOrder(order)
+}
+
+// 保存済みの注文にリクエストの内容(decode)を重ねて、金額の計算と検証をする(PUTとバッチ更新で共通)。
+// 金額はサーバ側で計算し直すので、リクエストで送られてきた場合だけ照合する
+// (明細の無い注文はamountを送る必要がある)
+func (h *OrderHandler) prepareUpdate(ctx context.Context, order *model.Order, decode func(obj any) error) error {
+	orderID, createdAt, deletedAt, whyDeleted, status := order.ID, order.CreatedAt, order.DeletedAt, order.WhyDeleted, order.Status
+	refundedAmount, refundedTax := order.RefundedAmount, order.RefundedTax
+	order.Amount, order.AmountWithoutTax, order.Tax = model.Money{}, model.Money{}, model.Money{}
+
+	if err := decode(order); err != nil {
+		return problem.BadRequest(fmt.Sprintf("Invalid request body: %v", err))
+	}
+
+	// ボディのidで別の注文を更新できないようにする。
+	// 作成日時(税率の基準日時)と削除の状態もボディで変えられないようにする。状態は遷移のエンドポイント(cancel/shipなど)で、
+	// 返金済みの金額は返金のエンドポイントでだけ変える
+	order.ID, order.Status = orderID, status
+	order.CreatedAt, order.DeletedAt, order.WhyDeleted = createdAt, deletedAt, whyDeleted
+	order.RefundedAmount, order.RefundedTax = refundedAmount, refundedTax
+	restrictOwner(ctx, order)
+
+	if err := h.applyTotals(ctx, order, nil, createdAt); err != nil {
+		return err
+	}
+	return h.validateOrder(order)
+}
+
+// 注文の金額をサーバ側で計算して設定する(atは税率を決める基準日時)。
+// 金額は注文のcurrency(未指定なら円)の最小単位で、明細も同じ通貨でなければならない
+//   - itemsを指定した場合: 明細から計算し、明細グループも一緒に作成する
+//   - order_item_group_idを指定した場合: 既存の明細グループの明細から計算する
+//   - どちらも無い(または明細が空の)場合: amount(税込)をtax_rate_idの税率で税抜金額と消費税に分ける
+func (h *OrderHandler) applyTotals(ctx context.Context, order *model.Order, items []model.OrderItem, at time.Time) error {
+	currency, err := model.ParseCurrency(string(order.Currency))
+	if err != nil {
+		return repository.Invalid("currency", "%s is not supported", order.Currency)
+	}
+	order.SetCurrency(currency)
+
+	if len(items) > 0 {
+		for i := range items {
+			if err := validateOrderItem(&items[i], currency); err != nil {
+				return repository.WithPrefix(err, fmt.Sprintf("items[%d].", i))
+			}
+			items[i].ID = 0
+			items[i].OrderItemGroupID = 0
+		}
+		if err := h.resolveTaxRates(ctx, order, items, at); err != nil {
+			return err
+		}
+		order.OrderItemGroupID = 0
+		order.OrderItemGroup = &model.OrderItemGroup{Items: items}
+		return calcError(h.calc.Apply(order, items))
+	}
+
+	order.OrderItemGroup = nil
+	if order.OrderItemGroupID != 0 {
+		group, err := h.repo.GetItemGroup(ctx, uint64(order.OrderItemGroupID))
+		if errors.Is(err, repository.ErrNotFound) {
+			return repository.Invalid("order_item_group_id", "%d not found", order.OrderItemGroupID)
+		}
+		if err != nil {
+			return err
+		}
+		if len(group.Items) > 0 {
+			return calcError(h.calc.Apply(order, group.Items))
+		}
+	}
+
+	if order.Amount.Amount <= 0 {
+		return repository.Invalid("amount", "is required when items and order_item_group_id are not given")
+	}
+	if err := h.resolveTaxRates(ctx, order, nil, at); err != nil {
+		return err
+	}
+	rate, err := h.effectiveTaxRate(ctx, order.TaxRateID, at)
+	if err != nil {
+		return err
+	}
+	return calcError(h.calc.ApplyInclusive(order, rate.Rate))
+}
+
+// 送られてきた金額と計算結果の不一致や、通貨の異なる明細を検証エラーにする
+func calcError(err error) error {
+	var mismatch *tax.MismatchError
+	if errors.As(err, &mismatch) {
+		return repository.Invalid(mismatch.Field, "%d does not match the calculated value (expected %d)", mismatch.Supplied, mismatch.Expected)
+	}
+	var currencyMismatch *model.CurrencyMismatchError
+	if errors.As(err, &currencyMismatch) {
+		return repository.Invalid("currency", "%s does not match the currency of the items (%s)", currencyMismatch.Left, currencyMismatch.Right)
+	}
+	return err
+}
+
+// 明細ごとの税率を税率テーブルから決めて、作成時点の税率(%)を明細に記録する。
+// 明細のtax_rate_idが未指定なら注文のtax_rate_id、それも未指定ならatの時点の標準税率を使う
+func (h *OrderHandler) resolveTaxRates(ctx context.Context, order *model.Order, items []model.OrderItem, at time.Time) error {
+	if order.TaxRateID == 0 {
+		standard, err := h.taxRates.FindEffective(ctx, model.TaxRateCodeStandard, at)
+		if err != nil {
+			// 税率テーブルの設定漏れなのでクライアントのエラーにはしない
+			return fmt.Errorf("standard tax rate is not configured: %v", err)
+		}
+		order.TaxRateID = standard.ID
+	}
+
+	rates := make(map[int64]*model.TaxRate)
+	for i := range items {
+		if items[i].TaxRateID == 0 {
+			items[i].TaxRateID = order.TaxRateID
+		}
+
+		rate, ok := rates[items[i].TaxRateID]
+		if !ok {
+			var err error
+			rate, err = h.effectiveTaxRate(ctx, items[i].TaxRateID, at)
+			if err != nil {
+				return repository.WithPrefix(err, fmt.Sprintf("items[%d].", i))
+			}
+			rates[rate.ID] = rate
+		}
+		items[i].TaxRate = rate.Rate
+	}
+	return nil
+}
+
+// 税率IDの税率がatの時点で有効であることを確認して返す
+func (h *OrderHandler) effectiveTaxRate(ctx context.Context, taxRateID int64, at time.Time) (*model.TaxRate, error) {
+	rate, err := h.taxRates.Get(ctx, uint64(taxRateID))
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, repository.Invalid("tax_rate_id", "%d not found", taxRateID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !rate.EffectiveAt(at) {
+		return nil, repository.Invalid("tax_rate_id", "%d is not effective at %s", taxRateID, at.Format(dateLayout))
+	}
+	return rate, nil
+}
+
+// 管理者以外は他のユーザーの注文を作成・更新できないので、user_idを本人にする
+func restrictOwner(ctx context.Context, order *model.Order) {
+	if owner, ok := repository.OwnerFrom(ctx); ok {
+		order.UserID = int64(owner)
+	}
+}
+
+// 管理者以外は他のユーザーの注文一覧を見られない
+func checkUserAccess(c *gin.Context, userID uint64) error {
+	if owner, ok := repository.OwnerFrom(c.Request.Context()); ok && owner != userID {
+		return problem.Forbidden("cannot access orders of another user")
+	}
+	return nil
+}
+
+// 明細を検証して、通貨を注文の通貨にする(明細のcurrencyは省略できるが、注文と異なる通貨は受け付けない)
+func validateOrderItem(item *model.OrderItem, currency model.Currency) error {
+	if item.Currency != "" {
+		itemCurrency, err := model.ParseCurrency(string(item.Currency))
+		if err != nil {
+			return repository.Invalid("currency", "%s is not supported", item.Currency)
+		}
+		if itemCurrency != currency {
+			return repository.Invalid("currency", "%s does not match the order currency (%s)", itemCurrency, currency)
+		}
+	}
+	item.SetCurrency(currency)
+
+	if item.ProductID == 0 {
+		return repository.Invalid("product_id", "is required")
+	}
+
+	if item.Quantity <= 0 {
+		return repository.Invalid("quantity", "must be greater than 0")
+	}
+
+	if item.UnitPrice.Amount < 0 {
+		return repository.Invalid("unit_price", "cannot be negative")
+	}
+
+	return nil
+}
+
 func (h *OrderHandler) validateOrder(order *model.Order) error {
 	if order.UserID == 0 {
-		return fmt.Errorf("user_id is required")
+		return repository.Invalid("user_id", "is required")
+	}
+
+	if order.Amount.Amount <= 0 {
+		return repository.Invalid("amount", "must be greater than 0")
 	}
 
-	if order.Amount <= 0 {
-		return fmt.Errorf("amount must be greater than 0")
+	if order.AmountWithoutTax.Amount < 0 {
+		return repository.Invalid("amount_without_tax", "cannot be negative")
 	}
 
-	if order.AmountWithoutTax < 0 {
-		return fmt.Errorf("amount_without_tax cannot be negative")
+	if order.Tax.Amount < 0 {
+		return repository.Invalid("tax", "cannot be negative")
 	}
 
-	if order.Tax < 0 {
-		return fmt.Errorf("tax cannot be negative")
+	if total, err := order.AmountWithoutTax.Add(order.Tax); err != nil || total != order.Amount {
+		return repository.Invalid("amount", "must equal amount_without_tax + tax")
 	}
 
 	return nil
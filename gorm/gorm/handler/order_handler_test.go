@@ -0,0 +1,138 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	gormConfig "github.com/makoto-developer/golang_examples/gorm/config"
+	"github.com/makoto-developer/golang_examples/gorm/gorm/database"
+	"github.com/makoto-developer/golang_examples/gorm/gorm/middleware"
+	"github.com/makoto-developer/golang_examples/gorm/gorm/model"
+	"github.com/makoto-developer/golang_examples/gorm/gorm/repository"
+	"github.com/makoto-developer/golang_examples/gorm/gorm/tax"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// メモリ上のSQLiteを使う注文のハンドラ
+func newTestHandler(t *testing.T) *OrderHandler {
+	t.Helper()
+	db, err := database.Open(gormConfig.DatabaseConfig{Driver: "sqlite", Path: ":memory:"}, &gorm.Config{
+		Logger: logger.Discard,
+	})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			_ = sqlDB.Close()
+		}
+	})
+
+	return NewOrderHandler(repository.NewOrderRepository(db), repository.NewTaxRateRepository(db), tax.NewCalculator(tax.RoundingFloor), 100)
+}
+
+// メモリ上のSQLiteを使う注文のルート
+func newTestRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	h := newTestHandler(t)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(middleware.Problem())
+	r.GET("/orders", h.GetOrders)
+	r.GET("/orders/:id", h.GetOrder)
+	r.POST("/orders", h.CreateOrder)
+	r.DELETE("/orders/:id", h.DeleteOrder)
+	r.POST("/orders/:id/restore", h.RestoreOrder)
+	return r
+}
+
+func serve(t *testing.T, r *gin.Engine, method, path, body string, out any) int {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if out != nil && w.Code < http.StatusBadRequest {
+		if err := json.Unmarshal(w.Body.Bytes(), out); err != nil {
+			t.Fatalf("%s %s: failed to decode %s: %v", method, path, w.Body.String(), err)
+		}
+	}
+	return w.Code
+}
+
+func TestCreateOrderIgnoresIDAndTimestamps(t *testing.T) {
+	r := newTestRouter(t)
+
+	var created model.Order
+	code := serve(t, r, http.MethodPost, "/orders", `{
+		"id": 999,
+		"user_id": 100,
+		"created_at": "2000-01-01T00:00:00Z",
+		"deleted_at": "2000-01-02T00:00:00Z",
+		"why_deleted": "x",
+		"items": [{"product_id": 10, "quantity": 2, "unit_price": 1000}]
+	}`, &created)
+	if code != http.StatusCreated {
+		t.Fatalf("POST /orders = %d, want 201", code)
+	}
+	if created.ID == 999 {
+		t.Error("id in the body was used")
+	}
+	if time.Since(created.CreatedAt) > time.Minute || created.DeletedAt.Valid || created.WhyDeleted != "" {
+		t.Errorf("created = %+v, want created_at now and not deleted", created)
+	}
+	// 2000年1月ではなく現在の標準税率(10%)で計算する
+	if created.Amount.Amount != 2200 || created.AmountWithoutTax.Amount != 2000 || created.Tax.Amount != 200 || created.Currency != "JPY" {
+		t.Errorf("amounts = (%v, %v, %v), want JPY (2200, 2000, 200)", created.Amount, created.AmountWithoutTax, created.Tax)
+	}
+
+	var got model.Order
+	if code := serve(t, r, http.MethodGet, "/orders/999", "", nil); code != http.StatusNotFound {
+		t.Errorf("GET /orders/999 = %d, want 404", code)
+	}
+	if code := serve(t, r, http.MethodGet, "/orders/"+strconv.FormatInt(created.ID, 10), "", &got); code != http.StatusOK || got.UserID != 100 {
+		t.Errorf("GET created order = %d %+v", code, got)
+	}
+}
+
+func TestOrderDeleteAndRestore(t *testing.T) {
+	r := newTestRouter(t)
+
+	var created model.Order
+	if code := serve(t, r, http.MethodPost, "/orders", `{"user_id": 100, "amount": 1100, "tax_rate_id": 3}`, &created); code != http.StatusCreated {
+		t.Fatalf("POST /orders = %d, want 201", code)
+	}
+	path := "/orders/" + strconv.FormatInt(created.ID, 10)
+
+	if code := serve(t, r, http.MethodDelete, path+"?reason=duplicate", "", nil); code != http.StatusOK {
+		t.Fatalf("DELETE = %d, want 200", code)
+	}
+	if code := serve(t, r, http.MethodGet, path, "", nil); code != http.StatusNotFound {
+		t.Errorf("GET deleted order = %d, want 404", code)
+	}
+	var page repository.OrderPage
+	if code := serve(t, r, http.MethodGet, "/orders?include_deleted=only", "", &page); code != http.StatusOK ||
+		len(page.Orders) != 1 || page.Orders[0].WhyDeleted != "duplicate" {
+		t.Errorf("GET deleted orders = %d %+v, want the order with its reason", code, page.Orders)
+	}
+
+	var restored model.Order
+	if code := serve(t, r, http.MethodPost, path+"/restore", "", &restored); code != http.StatusOK || restored.DeletedAt.Valid {
+		t.Fatalf("POST restore = %d %+v, want 200 and not deleted", code, restored)
+	}
+	if code := serve(t, r, http.MethodGet, path, "", nil); code != http.StatusOK {
+		t.Errorf("GET restored order = %d, want 200", code)
+	}
+	if code := serve(t, r, http.MethodPost, path+"/restore", "", nil); code != http.StatusNotFound {
+		t.Errorf("POST restore again = %d, want 404", code)
+	}
+}
@@ -0,0 +1,151 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/makoto-developer/golang_examples/gorm/gorm/model"
+	"github.com/makoto-developer/golang_examples/gorm/gorm/ordercsv"
+	"github.com/makoto-developer/golang_examples/gorm/gorm/problem"
+	"github.com/makoto-developer/golang_examples/gorm/gorm/repository"
+)
+
+// 取り込みに失敗した行
+type ImportError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+// ImportResult CSV取り込みの結果
+type ImportResult struct {
+	DryRun   bool          `json:"dry_run"`
+	Total    int           `json:"total"`    // データ行の数
+	Valid    int           `json:"valid"`    // 検証を通った行の数
+	Imported int           `json:"imported"` // 保存した行の数(dry_runなら0)
+	Errors   []ImportError `json:"errors"`
+	IDs      []int64       `json:"ids,omitempty"`
+}
+
+// ImportOrders CSVの注文を取り込む(POST /orders/import)。
+// multipart/form-dataのfile、またはtext/csvのボディを受け付ける
+func (h *OrderHandler) ImportOrders(c *gin.Context) {
+	dryRun := c.Query("dry_run") == "true"
+
+	body := io.Reader(c.Request.Body)
+	if strings.HasPrefix(c.ContentType(), "multipart/form-data") {
+		fh, err := c.FormFile("file")
+		if err != nil {
+			_ = c.Error(problem.BadRequest("file is required"))
+			return
+		}
+		f, err := fh.Open()
+		if err != nil {
+			_ = c.Error(problem.BadRequest(err.Error()))
+			return
+		}
+		defer f.Close()
+		body = f
+	}
+
+	result, err := h.Import(c.Request.Context(), body, dryRun)
+	var csvErr *csvHeaderError
+	if errors.As(err, &csvErr) {
+		_ = c.Error(problem.BadRequest(err.Error()))
+		return
+	}
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// Import CSVの各行をPOST /ordersと同じルールで検証し、検証を通った行を1つのトランザクションで保存する。
+// dryRunなら検証だけして保存しない(コマンドラインの import からも呼ぶ)
+func (h *OrderHandler) Import(ctx context.Context, r io.Reader, dryRun bool) (*ImportResult, error) {
+	reader, err := ordercsv.NewReader(r)
+	if err != nil {
+		return nil, &csvHeaderError{err}
+	}
+
+	result := &ImportResult{DryRun: dryRun, Errors: []ImportError{}}
+	var orders []*model.Order
+	for {
+		order, line, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		result.Total++
+		if err == nil {
+			err = h.prepareImport(ctx, order)
+		}
+		// タイムアウトした場合は残りの行もすべて失敗するので、行のエラーにせず中断する
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		if err != nil {
+			result.Errors = append(result.Errors, ImportError{Line: line, Error: err.Error()})
+			continue
+		}
+		orders = append(orders, order)
+	}
+	result.Valid = len(orders)
+
+	if dryRun || len(orders) == 0 {
+		return result, nil
+	}
+	if err := h.repo.SaveBatch(ctx, orders, nil, insertBatchSize); err != nil {
+		return nil, err
+	}
+	result.Imported = len(orders)
+	for _, order := range orders {
+		result.IDs = append(result.IDs, order.ID)
+	}
+	return result, nil
+}
+
+// 取り込む注文の金額を計算して検証する。created_atを指定した行は、その時点の税率で計算する。
+// 過去の日時の注文を作れるので、POST /orders/importは管理者だけにしている(importコマンドは認証無し)
+func (h *OrderHandler) prepareImport(ctx context.Context, order *model.Order) error {
+	at := time.Now()
+	if !order.CreatedAt.IsZero() {
+		if order.CreatedAt.After(at) {
+			return repository.Invalid("created_at", "cannot be in the future")
+		}
+		// 日時はUTCで保存する
+		order.CreatedAt = order.CreatedAt.UTC()
+		at = order.CreatedAt
+	}
+	restrictOwner(ctx, order)
+	// 取り込むのは過去の注文なので、statusを指定しない行は支払い済みにする。
+	// 指定した場合は、支払い待ちから状態遷移表の遷移でその状態になれるものだけを受け付ける
+	if order.Status == "" {
+		order.Status = model.OrderStatusPaid
+	}
+	if !model.OrderStatusPending.CanReach(order.Status) {
+		return repository.Invalid("status", "cannot be %s for a new order", order.Status)
+	}
+	// 返金の記録(refunded_amount/refunded_tax)は取り込まないので、返金済みにはできない
+	if order.Status == model.OrderStatusRefunded {
+		return repository.Invalid("status", "cannot be refunded (refunds are not imported)")
+	}
+	if err := h.applyTotals(ctx, order, nil, at); err != nil {
+		return err
+	}
+	return h.validateOrder(order)
+}
+
+// ヘッダー行が不正でCSV全体を読めない
+type csvHeaderError struct {
+	err error
+}
+
+func (e *csvHeaderError) Error() string { return e.err.Error() }
+
+func (e *csvHeaderError) Unwrap() error { return e.err }
@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/makoto-developer/golang_examples/gorm/gorm/model"
+)
+
+func TestImportStatus(t *testing.T) {
+	h := newTestHandler(t)
+	ctx := context.Background()
+
+	csv := "user_id,amount,tax_rate_id,status,created_at\n" +
+		"100,1100,3,,2024-01-10T10:00:00+09:00\n" + // statusなしは支払い済み
+		"100,1100,3,shipped,2024-01-10T10:00:00+09:00\n" +
+		"100,1100,3,lost,2024-01-10T10:00:00+09:00\n" +
+		"100,1100,3,paid,2999-01-01T00:00:00Z\n" +
+		"100,1100,3,refunded,2024-01-10T10:00:00+09:00\n"
+	result, err := h.Import(ctx, strings.NewReader(csv), false)
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	if result.Imported != 2 || len(result.Errors) != 3 {
+		t.Fatalf("result = %+v, want 2 imported and 3 errors", result)
+	}
+	if result.Errors[0].Line != 4 || result.Errors[1].Line != 5 || result.Errors[1].Error != "created_at cannot be in the future" ||
+		result.Errors[2].Line != 6 {
+		t.Errorf("errors = %+v, want the unknown status on line 4, the future created_at on line 5 and refunded on line 6", result.Errors)
+	}
+
+	for i, want := range []model.OrderStatus{model.OrderStatusPaid, model.OrderStatusShipped} {
+		order, err := h.repo.Get(ctx, uint64(result.IDs[i]))
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		if order.Status != want {
+			t.Errorf("order %d status = %s, want %s", order.ID, order.Status, want)
+		}
+	}
+}
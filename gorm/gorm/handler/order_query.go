@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/makoto-developer/golang_examples/gorm/gorm/model"
+	"github.com/makoto-developer/golang_examples/gorm/gorm/repository"
+)
+
+const dateLayout = "2006-01-02"
+
+// クエリパラメータから注文一覧の絞り込み条件を組み立てる
+func parseOrderFilter(c *gin.Context) (repository.OrderFilter, error) {
+	var filter repository.OrderFilter
+	var err error
+
+	if filter.Deleted, err = repository.ParseDeletedScope(c.Query("include_deleted")); err != nil {
+		return filter, err
+	}
+
+	if filter.UserID, err = parseUintQuery(c, "user_id"); err != nil {
+		return filter, err
+	}
+	if filter.OrderItemGroupID, err = parseUintQuery(c, "order_item_group_id"); err != nil {
+		return filter, err
+	}
+	if filter.CreatedFrom, err = parseTimeQuery(c, "created_from", false); err != nil {
+		return filter, err
+	}
+	if filter.CreatedTo, err = parseTimeQuery(c, "created_to", true); err != nil {
+		return filter, err
+	}
+	if s := c.Query("status"); s != "" {
+		if filter.Status, err = model.ParseOrderStatus(s); err != nil {
+			return filter, err
+		}
+	}
+	if s := c.Query("currency"); s != "" {
+		if filter.Currency, err = model.ParseCurrency(s); err != nil {
+			return filter, err
+		}
+	}
+	if filter.AmountMin, err = parseIntQuery(c, "amount_min"); err != nil {
+		return filter, err
+	}
+	if filter.AmountMax, err = parseIntQuery(c, "amount_max"); err != nil {
+		return filter, err
+	}
+
+	return filter, nil
+}
+
+// クエリパラメータからページ指定を組み立てる
+func parsePage(c *gin.Context) (repository.Page, error) {
+	var page repository.Page
+
+	if s := c.Query("limit"); s != "" {
+		limit, err := strconv.Atoi(s)
+		if err != nil || limit <= 0 {
+			return page, fmt.Errorf("invalid limit: %s", s)
+		}
+		page.Limit = limit
+	}
+
+	sort, err := repository.ParseSortOrder(c.Query("sort"))
+	if err != nil {
+		return page, err
+	}
+	page.Sort = sort
+	page.Cursor = c.Query("cursor")
+
+	return page, nil
+}
+
+func parseUintQuery(c *gin.Context, key string) (uint64, error) {
+	s := c.Query(key)
+	if s == "" {
+		return 0, nil
+	}
+	v, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %s", key, s)
+	}
+	return v, nil
+}
+
+func parseIntQuery(c *gin.Context, key string) (*int64, error) {
+	s := c.Query(key)
+	if s == "" {
+		return nil, nil
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %s", key, s)
+	}
+	return &v, nil
+}
+
+// RFC3339か日付(YYYY-MM-DD)を受け付ける。
+// 終端(endOfRange)に日付だけが指定された場合はその日を含むよう翌日0時を返す
+func parseTimeQuery(c *gin.Context, key string, endOfRange bool) (*time.Time, error) {
+	s := c.Query(key)
+	if s == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse(dateLayout, s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %s (use RFC3339 or YYYY-MM-DD)", key, s)
+	}
+	if endOfRange {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
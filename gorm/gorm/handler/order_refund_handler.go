@@ -0,0 +1,140 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/makoto-developer/golang_examples/gorm/gorm/model"
+	"github.com/makoto-developer/golang_examples/gorm/gorm/problem"
+	"github.com/makoto-developer/golang_examples/gorm/gorm/repository"
+)
+
+// 返金のリクエスト。金額は注文の通貨の最小単位
+type createRefundRequest struct {
+	Amount   int64  `json:"amount"`
+	Tax      *int64 `json:"tax"`      // 返金額のうち消費税(省略すると按分する)
+	Currency string `json:"currency"` // 省略可。指定する場合は注文の通貨と同じ
+	Reason   string `json:"reason"`
+}
+
+// 返金の結果
+type refundResponse struct {
+	Refund *model.Refund `json:"refund"`
+	Order  *model.Order  `json:"order"`
+}
+
+// CreateRefund 注文を返金する(POST /orders/:id/refunds)。
+// 残りを全て返金すると注文はrefundedになる。残りを超える返金は409にする
+func (h *OrderHandler) CreateRefund(c *gin.Context) {
+	id := c.Param("id")
+	orderID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		_ = c.Error(problem.BadRequest("Invalid order ID"))
+		return
+	}
+
+	var req createRefundRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(problem.BadRequest(fmt.Sprintf("Invalid request body: %v", err)))
+		return
+	}
+	amount, tax, reason, err := validateRefund(&req)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	refund, order, err := h.repo.CreateRefund(c.Request.Context(), orderID, amount, tax, reason)
+	var currencyMismatch *model.CurrencyMismatchError
+	if errors.As(err, &currencyMismatch) {
+		err = repository.Invalid("currency", "%s does not match the order currency (%s)", currencyMismatch.Right, currencyMismatch.Left)
+	}
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.Header("ETag", orderETag(order))
+	c.JSON(http.StatusCreated, refundResponse{Refund: refund, Order: order})
+}
+
+// 返金のリクエストを検証して金額にする(通貨を省略した場合は注文の通貨になるよう空のままにする)
+func validateRefund(req *createRefundRequest) (model.Money, *model.Money, string, error) {
+	var currency model.Currency
+	if strings.TrimSpace(req.Currency) != "" {
+		c, err := model.ParseCurrency(req.Currency)
+		if err != nil {
+			return model.Money{}, nil, "", repository.Invalid("currency", "%s is not supported", req.Currency)
+		}
+		currency = c
+	}
+
+	if req.Amount <= 0 {
+		return model.Money{}, nil, "", repository.Invalid("amount", "must be greater than 0")
+	}
+	var tax *model.Money
+	if req.Tax != nil {
+		if *req.Tax < 0 {
+			return model.Money{}, nil, "", repository.Invalid("tax", "cannot be negative")
+		}
+		if *req.Tax > req.Amount {
+			return model.Money{}, nil, "", repository.Invalid("tax", "cannot be greater than amount")
+		}
+		t := model.NewMoney(*req.Tax, currency)
+		tax = &t
+	}
+	reason := strings.TrimSpace(req.Reason)
+	if reason == "" {
+		return model.Money{}, nil, "", repository.Invalid("reason", "is required")
+	}
+	return model.NewMoney(req.Amount, currency), tax, reason, nil
+}
+
+// 注文の返金の記録
+type refundsResponse struct {
+	OrderID          int64             `json:"order_id"`
+	Currency         model.Currency    `json:"currency"`
+	Status           model.OrderStatus `json:"status"`
+	RefundedAmount   model.Money       `json:"refunded_amount"`
+	RefundedTax      model.Money       `json:"refunded_tax"`
+	RefundableAmount model.Money       `json:"refundable_amount"`
+	Refunds          []*model.Refund   `json:"refunds"`
+}
+
+// GetRefunds 注文の返金済みの金額・返金できる残りと返金の記録を返す(GET /orders/:id/refunds)
+func (h *OrderHandler) GetRefunds(c *gin.Context) {
+	id := c.Param("id")
+	orderID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		_ = c.Error(problem.BadRequest("Invalid order ID"))
+		return
+	}
+
+	order, err := h.repo.Get(c.Request.Context(), orderID)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	refunds, err := h.repo.ListRefunds(c.Request.Context(), orderID)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	if refunds == nil {
+		refunds = []*model.Refund{}
+	}
+
+	c.JSON(http.StatusOK, refundsResponse{
+		OrderID:          order.ID,
+		Currency:         order.Currency,
+		Status:           order.Status,
+		RefundedAmount:   order.RefundedAmount,
+		RefundedTax:      order.RefundedTax,
+		RefundableAmount: order.RefundableAmount(),
+		Refunds:          refunds,
+	})
+}
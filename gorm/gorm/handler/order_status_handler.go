@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/makoto-developer/golang_examples/gorm/gorm/model"
+	"github.com/makoto-developer/golang_examples/gorm/gorm/problem"
+	"github.com/makoto-developer/golang_examples/gorm/gorm/repository"
+)
+
+// PayOrder 支払い済みにする(POST /orders/:id/pay)
+func (h *OrderHandler) PayOrder(c *gin.Context) {
+	h.transitionOrder(c, model.OrderStatusPaid, false)
+}
+
+// ShipOrder 発送済みにする(POST /orders/:id/ship)
+func (h *OrderHandler) ShipOrder(c *gin.Context) {
+	h.transitionOrder(c, model.OrderStatusShipped, false)
+}
+
+// CancelOrder キャンセルする(POST /orders/:id/cancel)。理由は必須
+func (h *OrderHandler) CancelOrder(c *gin.Context) {
+	h.transitionOrder(c, model.OrderStatusCancelled, true)
+}
+
+// 注文の状態をtoに遷移させる。今の状態から遷移できない場合は409にする
+func (h *OrderHandler) transitionOrder(c *gin.Context, to model.OrderStatus, reasonRequired bool) {
+	id := c.Param("id")
+	orderID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		_ = c.Error(problem.BadRequest("Invalid order ID"))
+		return
+	}
+
+	reason, err := requestReason(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	if reasonRequired && reason == "" {
+		_ = c.Error(repository.Invalid("reason", "is required"))
+		return
+	}
+
+	order, err := h.repo.Transition(c.Request.Context(), orderID, to, reason)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.Header("ETag", orderETag(order))
+	c.JSON(http.StatusOK, order)
+}
+
+// 注文の状態遷移の記録
+type statusTransitionsResponse struct {
+	OrderID     int64                          `json:"order_id"`
+	Status      model.OrderStatus              `json:"status"`
+	Transitions []*model.OrderStatusTransition `json:"transitions"`
+}
+
+// GetStatusTransitions 注文の今の状態と状態遷移の記録を返す(GET /orders/:id/transitions)
+func (h *OrderHandler) GetStatusTransitions(c *gin.Context) {
+	id := c.Param("id")
+	orderID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		_ = c.Error(problem.BadRequest("Invalid order ID"))
+		return
+	}
+
+	order, err := h.repo.Get(c.Request.Context(), orderID)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	transitions, err := h.repo.ListStatusTransitions(c.Request.Context(), orderID)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	if transitions == nil {
+		transitions = []*model.OrderStatusTransition{}
+	}
+
+	c.JSON(http.StatusOK, statusTransitionsResponse{
+		OrderID:     order.ID,
+		Status:      order.Status,
+		Transitions: transitions,
+	})
+}
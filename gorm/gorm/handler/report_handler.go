@@ -0,0 +1,134 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/makoto-developer/golang_examples/gorm/gorm/model"
+	"github.com/makoto-developer/golang_examples/gorm/gorm/problem"
+	"github.com/makoto-developer/golang_examples/gorm/gorm/repository"
+)
+
+type ReportHandler struct {
+	repo     repository.ReportRepository
+	location *time.Location // tzを指定しない場合のタイムゾーン
+	currency model.Currency // currencyを指定しない場合の換算先(空なら換算しない)
+}
+
+func NewReportHandler(repo repository.ReportRepository, location *time.Location, currency model.Currency) *ReportHandler {
+	return &ReportHandler{
+		repo:     repo,
+		location: location,
+		currency: currency,
+	}
+}
+
+type salesReportResponse struct {
+	Period   repository.ReportPeriod  `json:"period"`
+	GroupBy  repository.ReportGroupBy `json:"group_by,omitempty"`
+	TimeZone string                   `json:"timezone"`
+	Currency model.Currency           `json:"currency,omitempty"`
+	Statuses []model.OrderStatus      `json:"statuses"`
+	Rows     []*repository.SalesRow   `json:"rows"`
+}
+
+// GetSalesReport 売上を期間ごとに集計する(GET /reports/sales)。
+// currencyを指定すると全ての通貨の売上をその通貨に換算して合算する。
+// statusを指定しなければ支払い済み・発送済み・返金済みの注文だけを集計する
+func (h *ReportHandler) GetSalesReport(c *gin.Context) {
+	q, err := h.parseSalesQuery(c)
+	if err != nil {
+		_ = c.Error(problem.BadRequest(err.Error()))
+		return
+	}
+
+	rows, err := h.repo.Sales(c.Request.Context(), q)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	if rows == nil {
+		rows = []*repository.SalesRow{}
+	}
+
+	c.JSON(http.StatusOK, salesReportResponse{
+		Period:   q.Period,
+		GroupBy:  q.GroupBy,
+		TimeZone: q.Location.String(),
+		Currency: q.Currency,
+		Statuses: q.Statuses,
+		Rows:     rows,
+	})
+}
+
+func (h *ReportHandler) parseSalesQuery(c *gin.Context) (repository.SalesQuery, error) {
+	var q repository.SalesQuery
+	var err error
+
+	if q.Period, err = repository.ParseReportPeriod(c.Query("period")); err != nil {
+		return q, err
+	}
+	if q.GroupBy, err = repository.ParseReportGroupBy(c.Query("group_by")); err != nil {
+		return q, err
+	}
+
+	q.Currency = h.currency
+	if s := c.Query("currency"); s != "" {
+		if q.Currency, err = model.ParseCurrency(s); err != nil {
+			return q, err
+		}
+	}
+
+	q.Location = h.location
+	if tz := c.Query("tz"); tz != "" {
+		if q.Location, err = time.LoadLocation(tz); err != nil {
+			return q, fmt.Errorf("invalid tz: %s", tz)
+		}
+	}
+
+	// 日付だけの指定は集計のタイムゾーンの0時として扱う
+	if q.From, err = parseReportTime(c, "from", q.Location, false); err != nil {
+		return q, err
+	}
+	if q.To, err = parseReportTime(c, "to", q.Location, true); err != nil {
+		return q, err
+	}
+	if q.UserID, err = parseUintQuery(c, "user_id"); err != nil {
+		return q, err
+	}
+	if q.Statuses, err = repository.ParseSalesStatuses(c.Query("status")); err != nil {
+		return q, err
+	}
+
+	deleted, err := repository.ParseDeletedScope(c.Query("include_deleted"))
+	if err != nil {
+		return q, err
+	}
+	if deleted == repository.DeletedOnly {
+		return q, fmt.Errorf("include_deleted=only is not supported for reports")
+	}
+	q.IncludeDeleted = deleted == repository.DeletedInclude
+
+	return q, nil
+}
+
+// parseTimeQueryと同じ形式を受け付けるが、日付はlocの日付として解釈する
+func parseReportTime(c *gin.Context, key string, loc *time.Location, endOfRange bool) (*time.Time, error) {
+	s := c.Query(key)
+	if s == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return &t, nil
+	}
+	t, err := time.ParseInLocation(dateLayout, s, loc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %s (use RFC3339 or YYYY-MM-DD)", key, s)
+	}
+	if endOfRange {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
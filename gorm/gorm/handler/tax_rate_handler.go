@@ -0,0 +1,28 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/makoto-developer/golang_examples/gorm/gorm/repository"
+)
+
+type TaxRateHandler struct {
+	repo repository.TaxRateRepository
+}
+
+func NewTaxRateHandler(repo repository.TaxRateRepository) *TaxRateHandler {
+	return &TaxRateHandler{
+		repo: repo,
+	}
+}
+
+func (h *TaxRateHandler) GetTaxRates(c *gin.Context) {
+	rates, err := h.repo.List(c.Request.Context())
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, rates)
+}
@@ -0,0 +1,96 @@
+package metrics
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"gorm.io/gorm"
+)
+
+var (
+	// QueryDuration SQLの実行時間
+	QueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "gorm_query_duration_seconds",
+		Help:    "Duration of SQL statements executed through GORM by operation and table.",
+		Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"operation", "table"})
+
+	// QueryErrors 失敗したSQLの数(レコードが見つからない場合は数えない)
+	QueryErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gorm_query_errors_total",
+		Help: "Number of SQL statements executed through GORM that returned an error, by operation and table.",
+	}, []string{"operation", "table"})
+)
+
+const startKey = "metrics:start"
+
+// GORMPlugin SQLの実行時間とエラーを記録するGORMのプラグイン(db.Useで登録する)
+type GORMPlugin struct{}
+
+func (GORMPlugin) Name() string {
+	return "metrics"
+}
+
+// Initialize SQLを実行するGORMのコールバックの前後で時間を測る
+func (GORMPlugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	hooks := []struct {
+		operation     string
+		before, after func(name string, fn func(*gorm.DB)) error
+	}{
+		{"create", cb.Create().Before("gorm:create").Register, cb.Create().After("gorm:create").Register},
+		{"query", cb.Query().Before("gorm:query").Register, cb.Query().After("gorm:query").Register},
+		{"update", cb.Update().Before("gorm:update").Register, cb.Update().After("gorm:update").Register},
+		{"delete", cb.Delete().Before("gorm:delete").Register, cb.Delete().After("gorm:delete").Register},
+		{"row", cb.Row().Before("gorm:row").Register, cb.Row().After("gorm:row").Register},
+		{"raw", cb.Raw().Before("gorm:raw").Register, cb.Raw().After("gorm:raw").Register},
+	}
+	for _, h := range hooks {
+		if err := h.before("metrics:before_"+h.operation, startTimer); err != nil {
+			return err
+		}
+		if err := h.after("metrics:after_"+h.operation, observe(h.operation)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func startTimer(db *gorm.DB) {
+	db.InstanceSet(startKey, time.Now())
+}
+
+func observe(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		v, ok := db.InstanceGet(startKey)
+		if !ok {
+			return
+		}
+		start := v.(time.Time)
+
+		// Rawで実行したSQLなどはテーブルが分からない
+		table := db.Statement.Table
+		if table == "" {
+			table = "unknown"
+		}
+		QueryDuration.WithLabelValues(operation, table).Observe(time.Since(start).Seconds())
+		if db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound) {
+			QueryErrors.WithLabelValues(operation, table).Inc()
+		}
+	}
+}
+
+// RegisterDBStats 接続プールの状態(sql.DBStats)をgo_sql_*のメトリクスとして公開する。
+// プールの名前はdb_nameラベルになる
+func RegisterDBStats(pools map[string]*sql.DB) error {
+	for name, pool := range pools {
+		if err := prometheus.Register(collectors.NewDBStatsCollector(pool, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
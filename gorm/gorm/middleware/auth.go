@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/makoto-developer/golang_examples/gorm/gorm/audit"
+	"github.com/makoto-developer/golang_examples/gorm/gorm/auth"
+	"github.com/makoto-developer/golang_examples/gorm/gorm/problem"
+	"github.com/makoto-developer/golang_examples/gorm/gorm/repository"
+)
+
+// Authenticate Authorization: Bearerのアクセストークン(jwt-authが発行したもの)を検証するミドルウェア。
+// トークンのユーザーを操作者にし、管理者以外はそのユーザーの注文だけを扱えるようにする
+func Authenticate(verifier *auth.Verifier) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, ok := bearerToken(c.GetHeader("Authorization"))
+		if !ok {
+			c.Header("WWW-Authenticate", "Bearer")
+			_ = c.Error(problem.Unauthorized("Authorization header with a Bearer token is required"))
+			c.Abort()
+			return
+		}
+		claims, err := verifier.Verify(token)
+		if err != nil {
+			c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+			_ = c.Error(problem.Unauthorized("Invalid or expired token"))
+			c.Abort()
+			return
+		}
+
+		ctx := auth.WithClaims(c.Request.Context(), claims)
+		ctx = audit.WithActor(ctx, claims.Actor())
+		if !claims.IsAdmin() {
+			ctx = repository.WithOwner(ctx, uint64(claims.UserID))
+		}
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+	}
+}
+
+// RequireAdmin 管理者以外のリクエストを403にするミドルウェア(Authenticateの後に使う)
+func RequireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if claims, ok := auth.ClaimsFrom(c.Request.Context()); !ok || !claims.IsAdmin() {
+			_ = c.Error(problem.Forbidden("admin role is required"))
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// "Bearer <token>"からトークンを取り出す(スキームの大文字小文字は区別しない)
+func bearerToken(header string) (string, bool) {
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
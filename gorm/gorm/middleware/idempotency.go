@@ -0,0 +1,138 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/makoto-developer/golang_examples/gorm/gorm/auth"
+	"github.com/makoto-developer/golang_examples/gorm/gorm/problem"
+	"github.com/makoto-developer/golang_examples/gorm/gorm/repository"
+)
+
+const (
+	IdempotencyKeyHeader = "Idempotency-Key"
+	maxIdempotencyKeyLen = 255
+)
+
+// レスポンスのボディを保存用に記録するResponseWriter
+type bodyRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *bodyRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *bodyRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Idempotency Idempotency-Keyヘッダー付きのリクエストを1回だけ処理するミドルウェア。
+// 同じキー・同じリクエストの再送には最初のレスポンスをそのまま返し、
+// 同じキーで内容の違うリクエストは422にする。キーはttlを過ぎると再利用できる。
+// キーはユーザーごとに別なので、他のユーザーと同じキーを使っても互いのレスポンスは返さない
+func Idempotency(repo repository.IdempotencyKeyRepository, ttl time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLen {
+			_ = c.Error(problem.BadRequest("Idempotency-Key is too long"))
+			c.Abort()
+			return
+		}
+		if claims, ok := auth.ClaimsFrom(c.Request.Context()); ok {
+			key = claims.Actor() + ":" + key
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			_ = c.Error(problem.BadRequest("Failed to read request body"))
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		fingerprint := requestFingerprint(c.Request.Method, c.FullPath(), body)
+		record, created, err := repo.Reserve(c.Request.Context(), key, fingerprint, time.Now().Add(ttl))
+		if err != nil {
+			_ = c.Error(err)
+			c.Abort()
+			return
+		}
+
+		if !created {
+			switch {
+			case record.Fingerprint != fingerprint:
+				_ = c.Error(problem.New(http.StatusUnprocessableEntity, problem.CodeIdempotencyKeyReused,
+					"Idempotency-Key was already used with a different request"))
+				c.Abort()
+			case !record.Completed():
+				_ = c.Error(problem.New(http.StatusConflict, problem.CodeIdempotencyInProgress,
+					"A request with this Idempotency-Key is still in progress"))
+				c.Abort()
+			default:
+				c.Header("Idempotent-Replayed", "true")
+				// エラーはすべてproblem+jsonで返している
+				contentType := "application/json; charset=utf-8"
+				if record.StatusCode >= http.StatusBadRequest {
+					contentType = problem.ContentType
+				}
+				c.Data(record.StatusCode, contentType, record.ResponseBody)
+				c.Abort()
+			}
+			return
+		}
+
+		// ハンドラがpanicした場合も処理中のままにせずキーを解放する(panicはgin.Recoveryに任せる)
+		defer func() {
+			if r := recover(); r != nil {
+				if err := repo.Release(context.WithoutCancel(c.Request.Context()), key); err != nil {
+					log.Printf("Failed to release idempotency key %q: %v", key, err)
+				}
+				panic(r)
+			}
+		}()
+
+		recorder := &bodyRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+		// ハンドラのエラーをここで書き出して、そのレスポンスを保存する
+		renderError(c)
+
+		// リクエストがタイムアウトしていても結果は保存する
+		ctx := context.WithoutCancel(c.Request.Context())
+		// サーバ側のエラー(タイムアウトを含む)は再試行で成功する可能性があるので保存しない
+		if status := recorder.Status(); status >= http.StatusInternalServerError {
+			err = repo.Release(ctx, key)
+		} else {
+			err = repo.Complete(ctx, key, status, recorder.body.Bytes())
+		}
+		if err != nil {
+			log.Printf("Failed to save idempotency key %q: %v", key, err)
+		}
+	}
+}
+
+// メソッド・ルート・ボディから計算したリクエストの指紋
+func requestFingerprint(method, path string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method))
+	h.Write([]byte{0})
+	h.Write([]byte(path))
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/makoto-developer/golang_examples/gorm/gorm/metrics"
+)
+
+// Metrics リクエストの数と処理時間をルートのテンプレート(/orders/:id など)ごとに記録するミドルウェア。
+// ステータスはProblemが書いたエラーレスポンスを含めるので、Problemより前に登録する
+func Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := routeTemplate(c)
+		status := strconv.Itoa(c.Writer.Status())
+		metrics.HTTPRequests.WithLabelValues(c.Request.Method, route, status).Inc()
+		metrics.HTTPRequestDuration.WithLabelValues(c.Request.Method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
+
+// リクエストのルートのテンプレート。ルートが無いリクエストはパスごとに値が増えないようにまとめる
+func routeTemplate(c *gin.Context) string {
+	route := c.FullPath()
+	if route == "" {
+		return "unmatched"
+	}
+	// エスケープしたルート(/orders\:batch)は元の形にする
+	return strings.ReplaceAll(route, `\:`, ":")
+}
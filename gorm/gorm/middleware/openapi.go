@@ -0,0 +1,117 @@
+package middleware
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/gin-gonic/gin"
+	"github.com/makoto-developer/golang_examples/gorm/gorm/repository"
+)
+
+func init() {
+	// POST /orders/importのtext/csvのボディ(中身はハンドラで検証する)
+	openapi3filter.RegisterBodyDecoder("text/csv", openapi3filter.FileBodyDecoder)
+}
+
+// ValidateRequest リクエストのパラメータとボディをOpenAPIの仕様書で検証するミドルウェア。
+// 違反していれば400(validation_failed)にしてハンドラを呼ばない。仕様書に無いルートはそのまま通す
+func ValidateRequest(doc *openapi3.T) (gin.HandlerFunc, error) {
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build openapi router: %w", err)
+	}
+	options := &openapi3filter.Options{
+		MultiError:         true,
+		AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+	}
+
+	return func(c *gin.Context) {
+		// /orders\:batchはエスケープを外して仕様書のパスと照合する
+		req := c.Request
+		if strings.Contains(req.URL.Path, `\:`) {
+			req = req.Clone(req.Context())
+			u := *req.URL
+			u.Path = strings.ReplaceAll(u.Path, `\:`, ":")
+			u.RawPath = ""
+			req.URL = &u
+		}
+
+		route, params, err := router.FindRoute(req)
+		if err != nil {
+			c.Next()
+			return
+		}
+
+		input := &openapi3filter.RequestValidationInput{
+			Request:    req,
+			PathParams: params,
+			Route:      route,
+			Options:    options,
+		}
+		// ボディは読み直せるように差し替えられる(Cloneしたリクエストからも元のリクエストに戻す)
+		err = openapi3filter.ValidateRequest(req.Context(), input)
+		c.Request.Body = req.Body
+		if err != nil {
+			_ = c.Error(requestValidationError(err))
+			c.Abort()
+			return
+		}
+		c.Next()
+	}, nil
+}
+
+// 仕様書の検証エラーを項目ごとの検証エラーにする
+func requestValidationError(err error) error {
+	ve := &repository.ValidationError{}
+	collectFieldErrors(ve, err, "")
+	return ve
+}
+
+// RequestErrorはUnwrapで中のエラーを返すのでerrors.Asは使わず、外側から順に型で判定する
+func collectFieldErrors(ve *repository.ValidationError, err error, field string) {
+	switch e := err.(type) {
+	case openapi3.MultiError:
+		for _, inner := range e {
+			collectFieldErrors(ve, inner, field)
+		}
+	case *openapi3filter.RequestError:
+		switch {
+		case e.Parameter != nil:
+			field = e.Parameter.Name
+		case e.RequestBody != nil && field == "":
+			field = "body"
+		}
+		if e.Err == nil {
+			ve.Fields = append(ve.Fields, repository.FieldError{Field: field, Message: e.Reason})
+			return
+		}
+		collectFieldErrors(ve, e.Err, field)
+	case *openapi3.SchemaError:
+		if pointer := e.JSONPointer(); len(pointer) > 0 {
+			field = fieldPath(pointer)
+		}
+		ve.Fields = append(ve.Fields, repository.FieldError{Field: field, Message: e.Reason})
+	default:
+		ve.Fields = append(ve.Fields, repository.FieldError{Field: field, Message: err.Error()})
+	}
+}
+
+// JSON Pointerの各要素をハンドラの検証エラーと同じ項目名にする(例: items/0/quantity -> items[0].quantity)
+func fieldPath(pointer []string) string {
+	var b strings.Builder
+	for _, p := range pointer {
+		if _, err := strconv.Atoi(p); err == nil {
+			b.WriteString("[" + p + "]")
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteString(".")
+		}
+		b.WriteString(p)
+	}
+	return b.String()
+}
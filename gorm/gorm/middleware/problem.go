@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/makoto-developer/golang_examples/gorm/gorm/problem"
+)
+
+// Problem ハンドラがc.Errorで設定したエラーをapplication/problem+json(RFC 7807)で返すミドルウェア。
+// エラーの種類からステータスとコードを決める(problem.From)
+func Problem() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		renderError(c)
+	}
+}
+
+// c.Errorsの最後のエラーを、まだレスポンスを書いていなければproblem+jsonで書く
+func renderError(c *gin.Context) {
+	if len(c.Errors) == 0 || c.Writer.Written() {
+		return
+	}
+	err := c.Errors.Last().Err
+
+	p := problem.From(err)
+	if p.Status == http.StatusInternalServerError {
+		// ドライバによってはctxのエラーを包まずに返すので、リクエストの期限も確認する
+		if errors.Is(c.Request.Context().Err(), context.DeadlineExceeded) {
+			p = problem.Timeout()
+		} else {
+			log.Printf("%s %s: %v", c.Request.Method, c.Request.URL.Path, err)
+		}
+	}
+	p.Instance = c.Request.URL.Path
+
+	body, _ := json.Marshal(p)
+	c.Data(p.Status, problem.ContentType, body)
+}
@@ -0,0 +1,23 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/makoto-developer/golang_examples/gorm/gorm/database"
+)
+
+const ReadPrimaryHeader = "X-Read-Primary"
+
+// ReadPrimary リクエスト中の読み込みをリードレプリカではなくプライマリで実行するミドルウェア。
+// 書き込みのリクエスト(GET/HEAD以外)は読み込んだ値を更新に使うので常にプライマリを使う。
+// GETでも X-Read-Primary: true を付ければ、書き込んだ直後の値を読める
+func ReadPrimary() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		method := c.Request.Method
+		if (method != http.MethodGet && method != http.MethodHead) || c.GetHeader(ReadPrimaryHeader) == "true" {
+			c.Request = c.Request.WithContext(database.WithPrimary(c.Request.Context()))
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/gin-gonic/gin"
+	"github.com/makoto-developer/golang_examples/gorm/gorm/audit"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+// RequestID リクエストIDをリクエストのcontextに設定するミドルウェア。
+// X-Request-IDが無ければ生成してレスポンスヘッダーにも返す(操作者はAuthenticateで設定する)
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(RequestIDHeader)
+		if requestID == "" {
+			requestID = newRequestID()
+		}
+		c.Header(RequestIDHeader, requestID)
+
+		c.Request = c.Request.WithContext(audit.WithRequestID(c.Request.Context(), requestID))
+
+		c.Next()
+	}
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+)
+
+// トレースを記録しないルート(監視からの定期的なリクエスト)
+var untracedRoutes = map[string]bool{
+	"/ping":    true,
+	"/healthz": true,
+	"/readyz":  true,
+	"/metrics": true,
+}
+
+// Tracing リクエストごとにスパンを作るミドルウェア。呼び出し元のtraceparentヘッダーがあればそのトレースに繋げる。
+// GORMのスパンはこのスパンの子になる
+func Tracing(service string) gin.HandlerFunc {
+	return otelgin.Middleware(service,
+		otelgin.WithSpanNameFormatter(func(c *gin.Context) string {
+			return c.Request.Method + " " + routeTemplate(c)
+		}),
+		otelgin.WithGinFilter(func(c *gin.Context) bool {
+			return !untracedRoutes[c.FullPath()]
+		}),
+	)
+}
@@ -0,0 +1,63 @@
+package model
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// 為替レート(1 BaseCurrency = Rate QuoteCurrency)。同じ通貨の組でも適用期間ごとに別の行になる
+type ExchangeRate struct {
+	ID            int64      `gorm:"primaryKey" json:"id"`
+	BaseCurrency  Currency   `gorm:"column:base_currency;size:3" json:"base_currency"`
+	QuoteCurrency Currency   `gorm:"column:quote_currency;size:3" json:"quote_currency"`
+	Rate          string     `gorm:"column:rate;type:numeric(20,10)" json:"rate"` // 10進数の文字列(例: 151.25)
+	EffectiveFrom time.Time  `gorm:"column:effective_from" json:"effective_from"`
+	EffectiveTo   *time.Time `gorm:"column:effective_to" json:"effective_to"`
+}
+
+// atの時点で有効か(EffectiveFromを含み、EffectiveToを含まない)
+func (r *ExchangeRate) EffectiveAt(at time.Time) bool {
+	if at.Before(r.EffectiveFrom) {
+		return false
+	}
+	return r.EffectiveTo == nil || at.Before(*r.EffectiveTo)
+}
+
+// Convert BaseCurrencyの金額をQuoteCurrencyに換算する(QuoteCurrencyの最小単位で四捨五入)
+func (r *ExchangeRate) Convert(m Money) (Money, error) {
+	if m.Currency != r.BaseCurrency {
+		return Money{}, &CurrencyMismatchError{Left: r.BaseCurrency, Right: m.Currency}
+	}
+	rate, ok := new(big.Rat).SetString(r.Rate)
+	if !ok {
+		return Money{}, fmt.Errorf("invalid exchange rate %s/%s: %s", r.BaseCurrency, r.QuoteCurrency, r.Rate)
+	}
+
+	// 最小単位の桁数の違いを合わせる(例: 12.34 USD = 1234セント × 150 × 10^(0-2) = 1851円)
+	v := new(big.Rat).Mul(new(big.Rat).SetInt64(m.Amount), rate)
+	switch d := r.QuoteCurrency.Digits() - m.Currency.Digits(); {
+	case d > 0:
+		v.Mul(v, pow10(d))
+	case d < 0:
+		v.Quo(v, pow10(-d))
+	}
+	return NewMoney(roundHalfUp(v), r.QuoteCurrency), nil
+}
+
+// 0から遠い方向に四捨五入する
+func roundHalfUp(v *big.Rat) int64 {
+	num := new(big.Int).Abs(v.Num())
+	den := v.Denom()
+	// (2*num + den) / (2*den)
+	q := new(big.Int).Add(new(big.Int).Lsh(num, 1), den)
+	q.Quo(q, new(big.Int).Lsh(den, 1))
+	if v.Sign() < 0 {
+		q.Neg(q)
+	}
+	return q.Int64()
+}
+
+func pow10(n int) *big.Rat {
+	return new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil))
+}
@@ -0,0 +1,18 @@
+package model
+
+import "time"
+
+// Idempotency-Keyヘッダーで受け付けたリクエストと、そのとき返したレスポンス
+type IdempotencyKey struct {
+	Key          string    `gorm:"primaryKey;column:key"`
+	Fingerprint  string    `gorm:"column:fingerprint"`
+	StatusCode   int       `gorm:"column:status_code"` // 0は処理中
+	ResponseBody []byte    `gorm:"column:response_body"`
+	CreatedAt    time.Time `gorm:"column:created_at"`
+	ExpiresAt    time.Time `gorm:"column:expires_at"`
+}
+
+// 処理が終わってレスポンスを保存済みか
+func (k *IdempotencyKey) Completed() bool {
+	return k.StatusCode != 0
+}
@@ -0,0 +1,241 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm/schema"
+)
+
+// Currency ISO 4217の通貨コード
+type Currency string
+
+// 通貨を扱う前の注文は全て円なので、通貨を指定しない場合は円にする
+const DefaultCurrency Currency = "JPY"
+
+// 扱える通貨の補助単位の桁数(ISO 4217のminor unit)と表示用の記号
+var currencies = map[Currency]struct {
+	digits int
+	symbol string
+}{
+	"JPY": {0, "¥"},
+	"USD": {2, "$"},
+	"EUR": {2, "€"},
+	"GBP": {2, "£"},
+	"CNY": {2, "CN¥"},
+	"KRW": {0, "₩"},
+	"TWD": {2, "NT$"},
+	"HKD": {2, "HK$"},
+	"SGD": {2, "S$"},
+	"AUD": {2, "A$"},
+	"THB": {2, "฿"},
+}
+
+// ParseCurrency 通貨コードを解釈する(小文字も受け付ける/空ならDefaultCurrency)
+func ParseCurrency(s string) (Currency, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	if s == "" {
+		return DefaultCurrency, nil
+	}
+	c := Currency(s)
+	if _, ok := currencies[c]; !ok {
+		return "", fmt.Errorf("unsupported currency: %s", s)
+	}
+	return c, nil
+}
+
+// Digits 補助単位の桁数(円は0、ドルは2)
+func (c Currency) Digits() int {
+	return currencies[c].digits
+}
+
+// Money 金額。Amountは通貨の最小単位(円・セントなど)の整数。
+// DBとJSONでは最小単位の整数だけを持ち、通貨は注文・明細のcurrencyに1つだけ持つ
+type Money struct {
+	Amount   int64
+	Currency Currency
+}
+
+func NewMoney(amount int64, currency Currency) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+// CurrencyMismatchError 通貨の異なる金額どうしを計算しようとした
+type CurrencyMismatchError struct {
+	Left  Currency
+	Right Currency
+}
+
+func (e *CurrencyMismatchError) Error() string {
+	return fmt.Sprintf("currency mismatch: %s and %s", e.Left, e.Right)
+}
+
+func (m Money) sameCurrency(o Money) error {
+	if m.Currency != o.Currency {
+		return &CurrencyMismatchError{Left: m.Currency, Right: o.Currency}
+	}
+	return nil
+}
+
+// Add 同じ通貨の金額を足す(通貨が異なればCurrencyMismatchError)
+func (m Money) Add(o Money) (Money, error) {
+	if err := m.sameCurrency(o); err != nil {
+		return Money{}, err
+	}
+	return Money{Amount: m.Amount + o.Amount, Currency: m.Currency}, nil
+}
+
+// Sub 同じ通貨の金額を引く(通貨が異なればCurrencyMismatchError)
+func (m Money) Sub(o Money) (Money, error) {
+	if err := m.sameCurrency(o); err != nil {
+		return Money{}, err
+	}
+	return Money{Amount: m.Amount - o.Amount, Currency: m.Currency}, nil
+}
+
+// Mul 数量を掛ける
+func (m Money) Mul(n int64) Money {
+	return Money{Amount: m.Amount * n, Currency: m.Currency}
+}
+
+// Format 通貨の記号と桁区切りを付けて表示する(例: ¥1,100 / $12.34 / -€0.50)
+func (m Money) Format() string {
+	digits := m.Currency.Digits()
+	amount := m.Amount
+	sign := ""
+	if amount < 0 {
+		sign, amount = "-", -amount
+	}
+
+	s := strconv.FormatInt(amount, 10)
+	if len(s) <= digits {
+		s = strings.Repeat("0", digits-len(s)+1) + s
+	}
+	integer, fraction := s[:len(s)-digits], s[len(s)-digits:]
+
+	var b strings.Builder
+	for i, r := range integer {
+		if i > 0 && (len(integer)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(r)
+	}
+	if fraction != "" {
+		b.WriteString("." + fraction)
+	}
+
+	symbol := currencies[m.Currency].symbol
+	if symbol == "" {
+		return sign + b.String() + " " + string(m.Currency)
+	}
+	return sign + symbol + b.String()
+}
+
+func (m Money) String() string {
+	return m.Format()
+}
+
+// JSONでは最小単位の整数にする(通貨は注文・明細のcurrency)
+func (m Money) MarshalJSON() ([]byte, error) {
+	return strconv.AppendInt(nil, m.Amount, 10), nil
+}
+
+// 最小単位の整数を読む(通貨はそのまま)
+func (m *Money) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		return nil
+	}
+	n, err := strconv.ParseInt(string(b), 10, 64)
+	if err != nil {
+		return fmt.Errorf("money must be an integer in minor units: %s", b)
+	}
+	m.Amount = n
+	return nil
+}
+
+// Value mapでの更新や検索条件では最小単位の整数にする
+func (m Money) Value() (driver.Value, error) {
+	return m.Amount, nil
+}
+
+// GormDataType シリアライザを使っても整数のカラムにする
+func (Money) GormDataType() string {
+	return string(schema.Int)
+}
+
+func init() {
+	schema.RegisterSerializer("money", moneySerializer{})
+	schema.RegisterSerializer("currency", currencySerializer{})
+}
+
+// moneySerializer Moneyのフィールドを最小単位の整数のカラムに保存するシリアライザ(serializer:money)。
+// 通貨は同じ構造体のCurrencyフィールド(serializer:currency)から設定する
+type moneySerializer struct{}
+
+func (moneySerializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue any) error {
+	var amount sql.NullInt64
+	if err := amount.Scan(dbValue); err != nil {
+		return fmt.Errorf("failed to scan %s: %w", field.DBName, err)
+	}
+	m := Money{Amount: amount.Int64, Currency: currencyOf(ctx, field.Schema, dst)}
+	field.ReflectValueOf(ctx, dst).Set(reflect.ValueOf(m))
+	return nil
+}
+
+// 保存する金額の通貨がCurrencyフィールドと異なる場合はエラーにする
+func (moneySerializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue any) (any, error) {
+	m, ok := fieldValue.(Money)
+	if !ok {
+		return nil, fmt.Errorf("unsupported type for money: %T", fieldValue)
+	}
+	if currency := currencyOf(ctx, field.Schema, dst); m.Currency != "" && m.Currency != currency {
+		return nil, fmt.Errorf("%s: %w", field.DBName, &CurrencyMismatchError{Left: currency, Right: m.Currency})
+	}
+	return m.Amount, nil
+}
+
+// currencySerializer 構造体の通貨(serializer:currency)。
+// カラムの順番によってはMoneyのフィールドを先に読むので、読んだ通貨をMoneyのフィールドにも設定する
+type currencySerializer struct{}
+
+func (currencySerializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue any) error {
+	var s sql.NullString
+	if err := s.Scan(dbValue); err != nil {
+		return fmt.Errorf("failed to scan %s: %w", field.DBName, err)
+	}
+	currency := Currency(s.String)
+	if currency == "" {
+		currency = DefaultCurrency
+	}
+	field.ReflectValueOf(ctx, dst).Set(reflect.ValueOf(currency))
+
+	for _, f := range field.Schema.Fields {
+		if f.FieldType == reflect.TypeOf(Money{}) {
+			f.ReflectValueOf(ctx, dst).FieldByName("Currency").Set(reflect.ValueOf(currency))
+		}
+	}
+	return nil
+}
+
+func (currencySerializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue any) (any, error) {
+	currency, _ := fieldValue.(Currency)
+	if currency == "" {
+		currency = DefaultCurrency
+	}
+	return string(currency), nil
+}
+
+// 構造体のCurrencyフィールドの通貨(未設定ならDefaultCurrency)
+func currencyOf(ctx context.Context, s *schema.Schema, dst reflect.Value) Currency {
+	if field := s.LookUpField("Currency"); field != nil {
+		if currency, _ := field.ReflectValueOf(ctx, dst).Interface().(Currency); currency != "" {
+			return currency
+		}
+	}
+	return DefaultCurrency
+}
@@ -1,19 +1,71 @@
 package model
 
 import (
+	"encoding/json"
 	"time"
 
 	"gorm.io/gorm"
 )
 
+// 注文。金額は全てCurrencyの通貨
 type Order struct {
 	ID               int64          `gorm:"primaryKey" json:"id"`
-	OrderItemGroupID int64          `gorm:"order_item_group_id"`
-	UserID           int64          `gorm:"user_id" gorm:"index"`
-	Amount           int64          `gorm:"amount"`
-	AmountWithoutTax int64          `gorm:"amount_without_tax"`
-	Tax              int64          `gorm:"tax"`
-	CreatedAt        time.Time      `gorm:"created_at"`
-	UpdatedAt        time.Time      `gorm:"updated_at"`
-	DeletedAt        gorm.DeletedAt `gorm:"deleted_at"`
+	OrderItemGroupID int64          `gorm:"column:order_item_group_id" json:"order_item_group_id"`
+	UserID           int64          `gorm:"column:user_id;index" json:"user_id"`
+	Currency         Currency       `gorm:"column:currency;size:3;not null;default:JPY;serializer:currency" json:"currency"`
+	Amount           Money          `gorm:"column:amount;serializer:money" json:"amount"`
+	AmountWithoutTax Money          `gorm:"column:amount_without_tax;serializer:money" json:"amount_without_tax"`
+	Tax              Money          `gorm:"column:tax;serializer:money" json:"tax"`
+	RefundedAmount   Money          `gorm:"column:refunded_amount;not null;default:0;serializer:money" json:"refunded_amount"` // 返金済みの金額(税込)
+	RefundedTax      Money          `gorm:"column:refunded_tax;not null;default:0;serializer:money" json:"refunded_tax"`       // 返金済みの金額のうち消費税
+	TaxRateID        int64          `gorm:"column:tax_rate_id" json:"tax_rate_id"`
+	Status           OrderStatus    `gorm:"column:status;size:16;not null;default:pending" json:"status"`
+	CreatedAt        time.Time      `gorm:"column:created_at" json:"created_at"`
+	UpdatedAt        time.Time      `gorm:"column:updated_at" json:"updated_at"`
+	DeletedAt        gorm.DeletedAt `gorm:"column:deleted_at" json:"deleted_at"`
+	WhyDeleted       string         `gorm:"column:why_deleted" json:"why_deleted,omitempty"`
+	Version          int64          `gorm:"column:version" json:"version"`
+
+	OrderItemGroup *OrderItemGroup `gorm:"foreignKey:OrderItemGroupID" json:"order_item_group,omitempty"`
+}
+
+// SetCurrency 注文の通貨を設定して、金額の通貨も揃える
+func (o *Order) SetCurrency(currency Currency) {
+	o.Currency = currency
+	o.Amount.Currency = currency
+	o.AmountWithoutTax.Currency = currency
+	o.Tax.Currency = currency
+	o.RefundedAmount.Currency = currency
+	o.RefundedTax.Currency = currency
+}
+
+// NetAmount 返金を差し引いた金額(税込)
+func (o *Order) NetAmount() Money {
+	return o.RefundableAmount()
+}
+
+// NetTax 返金を差し引いた消費税
+func (o *Order) NetTax() Money {
+	return o.RefundableTax()
+}
+
+// NetAmountWithoutTax 返金を差し引いた金額(税抜)
+func (o *Order) NetAmountWithoutTax() Money {
+	return o.RefundableAmountWithoutTax()
+}
+
+// 返金を差し引いた金額(net_*)も一緒にJSONにする(リクエストのnet_*は読まない)
+func (o Order) MarshalJSON() ([]byte, error) {
+	type order Order
+	return json.Marshal(struct {
+		order
+		NetAmount           Money `json:"net_amount"`
+		NetAmountWithoutTax Money `json:"net_amount_without_tax"`
+		NetTax              Money `json:"net_tax"`
+	}{
+		order:               order(o),
+		NetAmount:           o.NetAmount(),
+		NetAmountWithoutTax: o.NetAmountWithoutTax(),
+		NetTax:              o.NetTax(),
+	})
 }
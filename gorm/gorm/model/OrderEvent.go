@@ -0,0 +1,38 @@
+package model
+
+import "time"
+
+// 注文の変更の種類
+type OrderEventType string
+
+const (
+	OrderEventCreated  OrderEventType = "created"
+	OrderEventUpdated  OrderEventType = "updated"
+	OrderEventDeleted  OrderEventType = "deleted"
+	OrderEventRestored OrderEventType = "restored"
+	// 状態の遷移(遷移先の状態と同じ名前)
+	OrderEventPaid      OrderEventType = "paid"
+	OrderEventShipped   OrderEventType = "shipped"
+	OrderEventCancelled OrderEventType = "cancelled"
+	OrderEventRefunded  OrderEventType = "refunded"
+	// 一部の返金(全額の返金はrefunded)
+	OrderEventPartiallyRefunded OrderEventType = "partially_refunded"
+)
+
+// StatusEventType 状態の遷移先に対応する変更の種類
+func StatusEventType(to OrderStatus) OrderEventType {
+	return OrderEventType(to)
+}
+
+// 注文の変更履歴。Before/Afterは変更前後の注文、Changesは変わった項目ごとの{"from", "to"}
+type OrderEvent struct {
+	ID        int64          `gorm:"primaryKey" json:"id"`
+	OrderID   int64          `gorm:"column:order_id;index" json:"order_id"`
+	EventType OrderEventType `gorm:"column:event_type" json:"event_type"`
+	Actor     string         `gorm:"column:actor" json:"actor"`
+	RequestID string         `gorm:"column:request_id" json:"request_id"`
+	Before    JSON           `gorm:"column:before" json:"before"`
+	After     JSON           `gorm:"column:after" json:"after"`
+	Changes   JSON           `gorm:"column:changes" json:"changes"`
+	CreatedAt time.Time      `gorm:"column:created_at" json:"created_at"`
+}
@@ -0,0 +1,34 @@
+package model
+
+import "time"
+
+// 1回の注文に含まれる明細のまとまり
+type OrderItemGroup struct {
+	ID        int64       `gorm:"primaryKey" json:"id"`
+	Items     []OrderItem `gorm:"foreignKey:OrderItemGroupID" json:"items"`
+	CreatedAt time.Time   `gorm:"column:created_at" json:"created_at"`
+}
+
+// 注文明細。UnitPriceはCurrencyの税抜単価、TaxRateは作成時点のTaxRateIDの税率(%)
+type OrderItem struct {
+	ID               int64     `gorm:"primaryKey" json:"id"`
+	OrderItemGroupID int64     `gorm:"column:order_item_group_id;index" json:"order_item_group_id"`
+	ProductID        int64     `gorm:"column:product_id" json:"product_id"`
+	Quantity         int64     `gorm:"column:quantity" json:"quantity"`
+	Currency         Currency  `gorm:"column:currency;size:3;not null;default:JPY;serializer:currency" json:"currency"`
+	UnitPrice        Money     `gorm:"column:unit_price;serializer:money" json:"unit_price"`
+	TaxRateID        int64     `gorm:"column:tax_rate_id" json:"tax_rate_id"`
+	TaxRate          int64     `gorm:"column:tax_rate" json:"tax_rate"`
+	CreatedAt        time.Time `gorm:"column:created_at" json:"created_at"`
+}
+
+// 税抜小計
+func (i OrderItem) Subtotal() Money {
+	return i.UnitPrice.Mul(i.Quantity)
+}
+
+// SetCurrency 明細の通貨を設定して、単価の通貨も揃える
+func (i *OrderItem) SetCurrency(currency Currency) {
+	i.Currency = currency
+	i.UnitPrice.Currency = currency
+}
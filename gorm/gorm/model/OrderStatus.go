@@ -0,0 +1,97 @@
+package model
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// 注文の状態
+type OrderStatus string
+
+const (
+	OrderStatusPending   OrderStatus = "pending"   // 支払い待ち(作成直後)
+	OrderStatusPaid      OrderStatus = "paid"      // 支払い済み
+	OrderStatusShipped   OrderStatus = "shipped"   // 発送済み
+	OrderStatusCancelled OrderStatus = "cancelled" // キャンセル
+	OrderStatusRefunded  OrderStatus = "refunded"  // 返金済み
+)
+
+// 状態遷移表。ここに無い遷移はできない(cancelled/refundedからはどこにも遷移しない)
+var orderStatusTransitions = map[OrderStatus][]OrderStatus{
+	OrderStatusPending: {OrderStatusPaid, OrderStatusCancelled},
+	OrderStatusPaid:    {OrderStatusShipped, OrderStatusCancelled, OrderStatusRefunded},
+	OrderStatusShipped: {OrderStatusRefunded},
+}
+
+// ParseOrderStatus 状態を解釈する
+func ParseOrderStatus(s string) (OrderStatus, error) {
+	switch OrderStatus(s) {
+	case OrderStatusPending, OrderStatusPaid, OrderStatusShipped, OrderStatusCancelled, OrderStatusRefunded:
+		return OrderStatus(s), nil
+	}
+	return "", fmt.Errorf("unsupported status: %s", s)
+}
+
+// CanTransitionTo toに遷移できるか
+func (s OrderStatus) CanTransitionTo(to OrderStatus) bool {
+	return slices.Contains(orderStatusTransitions[s], to)
+}
+
+// CanReach 状態遷移表の遷移を繰り返してtoになれるか(同じ状態ならtrue)
+func (s OrderStatus) CanReach(to OrderStatus) bool {
+	seen := map[OrderStatus]bool{s: true}
+	queue := []OrderStatus{s}
+	for len(queue) > 0 {
+		from := queue[0]
+		queue = queue[1:]
+		if from == to {
+			return true
+		}
+		for _, next := range orderStatusTransitions[from] {
+			if !seen[next] {
+				seen[next] = true
+				queue = append(queue, next)
+			}
+		}
+	}
+	return false
+}
+
+// TransitionError 状態遷移表に無い遷移をしようとした
+type TransitionError struct {
+	From OrderStatus
+	To   OrderStatus
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("order cannot transition from %s to %s", e.From, e.To)
+}
+
+// TransitionTo 注文の状態をtoにする(遷移できなければTransitionError)。遷移の記録を返す
+func (o *Order) TransitionTo(to OrderStatus, reason string, at time.Time) (*OrderStatusTransition, error) {
+	if !o.Status.CanTransitionTo(to) {
+		return nil, &TransitionError{From: o.Status, To: to}
+	}
+	transition := &OrderStatusTransition{
+		OrderID:    o.ID,
+		FromStatus: o.Status,
+		ToStatus:   to,
+		Reason:     reason,
+		CreatedAt:  at,
+	}
+	o.Status = to
+	return transition, nil
+}
+
+// 注文の状態遷移の記録
+type OrderStatusTransition struct {
+	ID         int64       `gorm:"primaryKey" json:"id"`
+	OrderID    int64       `gorm:"column:order_id;index" json:"order_id"`
+	FromStatus OrderStatus `gorm:"column:from_status" json:"from_status"`
+	ToStatus   OrderStatus `gorm:"column:to_status" json:"to_status"`
+	Reason     string      `gorm:"column:reason" json:"reason"`
+	Actor      string      `gorm:"column:actor" json:"actor"`
+	RequestID  string      `gorm:"column:request_id" json:"request_id"`
+	CreatedAt  time.Time   `gorm:"column:created_at" json:"created_at"`
+}
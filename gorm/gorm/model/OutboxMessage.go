@@ -0,0 +1,34 @@
+package model
+
+import "time"
+
+// RabbitMQに送るメッセージの種類
+const (
+	MessageOrderCreated           = "OrderCreated"
+	MessageOrderUpdated           = "OrderUpdated"
+	MessageOrderDeleted           = "OrderDeleted"
+	MessageOrderRestored          = "OrderRestored"
+	MessageOrderPaid              = "OrderPaid"
+	MessageOrderShipped           = "OrderShipped"
+	MessageOrderCancelled         = "OrderCancelled"
+	MessageOrderRefunded          = "OrderRefunded"
+	MessageOrderPartiallyRefunded = "OrderPartiallyRefunded"
+)
+
+// RabbitMQに送るメッセージ。データの変更と同じトランザクションで書き込み、relayが後から送信する
+type OutboxMessage struct {
+	ID            int64      `gorm:"primaryKey" json:"id"`
+	AggregateType string     `gorm:"column:aggregate_type" json:"aggregate_type"`
+	AggregateID   int64      `gorm:"column:aggregate_id" json:"aggregate_id"`
+	MessageType   string     `gorm:"column:message_type" json:"message_type"`
+	Payload       JSON       `gorm:"column:payload" json:"payload"`
+	Attempts      int        `gorm:"column:attempts" json:"attempts"`
+	LastError     string     `gorm:"column:last_error" json:"last_error"`
+	CreatedAt     time.Time  `gorm:"column:created_at" json:"created_at"`
+	ClaimedUntil  *time.Time `gorm:"column:claimed_until" json:"claimed_until"` // relayが送信中(この日時まで他のrelayは送らない)
+	SentAt        *time.Time `gorm:"column:sent_at" json:"sent_at"`
+}
+
+func (OutboxMessage) TableName() string {
+	return "outbox"
+}
@@ -0,0 +1,109 @@
+package model
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// 注文の返金。金額は全て注文の通貨
+type Refund struct {
+	ID        int64     `gorm:"primaryKey" json:"id"`
+	OrderID   int64     `gorm:"column:order_id;index" json:"order_id"`
+	Currency  Currency  `gorm:"column:currency;size:3;not null;default:JPY;serializer:currency" json:"currency"`
+	Amount    Money     `gorm:"column:amount;serializer:money" json:"amount"` // 返金額(税込)
+	Tax       Money     `gorm:"column:tax;serializer:money" json:"tax"`       // 返金額のうち消費税
+	Reason    string    `gorm:"column:reason" json:"reason"`
+	CreatedBy string    `gorm:"column:created_by" json:"created_by"`
+	RequestID string    `gorm:"column:request_id" json:"request_id"`
+	CreatedAt time.Time `gorm:"column:created_at" json:"created_at"`
+}
+
+// RefundExceededError 返金できる残りの金額を超えて返金しようとした
+type RefundExceededError struct {
+	Field      string // amount / amount_without_tax / tax
+	Requested  Money
+	Refundable Money
+}
+
+func (e *RefundExceededError) Error() string {
+	return fmt.Sprintf("refund %s %s exceeds the refundable %s", e.Field, e.Requested.Format(), e.Refundable.Format())
+}
+
+// RefundableAmount 返金できる残りの金額(税込)
+func (o *Order) RefundableAmount() Money {
+	return NewMoney(o.Amount.Amount-o.RefundedAmount.Amount, o.Currency)
+}
+
+// RefundableTax 返金できる残りの消費税
+func (o *Order) RefundableTax() Money {
+	return NewMoney(o.Tax.Amount-o.RefundedTax.Amount, o.Currency)
+}
+
+// RefundableAmountWithoutTax 返金できる残りの金額(税抜)
+func (o *Order) RefundableAmountWithoutTax() Money {
+	return NewMoney(o.RefundableAmount().Amount-o.RefundableTax().Amount, o.Currency)
+}
+
+// FullyRefunded 全額を返金済みか
+func (o *Order) FullyRefunded() bool {
+	return o.RefundedAmount.Amount > 0 && o.RefundableAmount().Amount <= 0
+}
+
+// Refund 注文を返金して返金の記録を返す。
+// taxがnilなら返金額を残りの税込金額と消費税の比で按分する(残りを全て返金する場合は残りの消費税)。
+// 返金できる状態(paid/shipped)でなければTransitionError、残りを超える場合はRefundExceededError
+func (o *Order) Refund(amount Money, tax *Money, reason string, at time.Time) (*Refund, error) {
+	if !o.Status.CanTransitionTo(OrderStatusRefunded) {
+		return nil, &TransitionError{From: o.Status, To: OrderStatusRefunded}
+	}
+	if amount.Currency != o.Currency {
+		return nil, &CurrencyMismatchError{Left: o.Currency, Right: amount.Currency}
+	}
+
+	refundable, refundableTax := o.RefundableAmount(), o.RefundableTax()
+	if amount.Amount > refundable.Amount {
+		return nil, &RefundExceededError{Field: "amount", Requested: amount, Refundable: refundable}
+	}
+
+	var refundTax Money
+	switch {
+	case tax != nil:
+		if tax.Currency != o.Currency {
+			return nil, &CurrencyMismatchError{Left: o.Currency, Right: tax.Currency}
+		}
+		refundTax = *tax
+	case amount.Amount == refundable.Amount:
+		refundTax = refundableTax
+	default:
+		refundTax = NewMoney(prorate(amount.Amount, refundableTax.Amount, refundable.Amount), o.Currency)
+	}
+	if refundTax.Amount > refundableTax.Amount {
+		return nil, &RefundExceededError{Field: "tax", Requested: refundTax, Refundable: refundableTax}
+	}
+	// 税抜の残りも超えないようにする(全額返金なら消費税も残りと一致する)
+	if withoutTax, refundableWithoutTax := amount.Amount-refundTax.Amount, o.RefundableAmountWithoutTax(); withoutTax > refundableWithoutTax.Amount {
+		return nil, &RefundExceededError{Field: "amount_without_tax", Requested: NewMoney(withoutTax, o.Currency), Refundable: refundableWithoutTax}
+	}
+
+	o.RefundedAmount = NewMoney(o.RefundedAmount.Amount+amount.Amount, o.Currency)
+	o.RefundedTax = NewMoney(o.RefundedTax.Amount+refundTax.Amount, o.Currency)
+	return &Refund{
+		OrderID:   o.ID,
+		Currency:  o.Currency,
+		Amount:    amount,
+		Tax:       refundTax,
+		Reason:    reason,
+		CreatedAt: at,
+	}, nil
+}
+
+// amount * part / total を四捨五入する(0 <= amount, part <= total)。
+// 掛け算がint64を超えないよう、big.Intで (2*amount*part + total) / (2*total) を計算する
+func prorate(amount, part, total int64) int64 {
+	num := new(big.Int).Mul(big.NewInt(amount), big.NewInt(part))
+	num.Mul(num, big.NewInt(2))
+	num.Add(num, big.NewInt(total))
+	den := new(big.Int).Mul(big.NewInt(total), big.NewInt(2))
+	return num.Quo(num, den).Int64()
+}
@@ -0,0 +1,92 @@
+package model
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func paidOrder(amount, tax, refundedAmount, refundedTax int64) *Order {
+	o := &Order{
+		ID:             1,
+		Status:         OrderStatusPaid,
+		Amount:         NewMoney(amount, "JPY"),
+		Tax:            NewMoney(tax, "JPY"),
+		RefundedAmount: NewMoney(refundedAmount, "JPY"),
+		RefundedTax:    NewMoney(refundedTax, "JPY"),
+	}
+	o.AmountWithoutTax = NewMoney(amount-tax, "JPY")
+	o.SetCurrency("JPY")
+	return o
+}
+
+func TestOrderRefund(t *testing.T) {
+	tax := func(n int64) *Money {
+		m := NewMoney(n, "JPY")
+		return &m
+	}
+	tests := []struct {
+		name                     string
+		order                    *Order
+		amount                   int64
+		tax                      *Money
+		wantTax                  int64 // 返金の消費税
+		wantRefunded, wantRefTax int64 // 返金後の返金済みの金額
+		wantFull                 bool
+		wantExceeded             string // RefundExceededErrorのField
+	}{
+		{"partial prorated", paidOrder(1100, 100, 0, 0), 330, nil, 30, 330, 30, false, ""},
+		{"partial prorated rounds half up", paidOrder(1080, 80, 0, 0), 100, nil, 7, 100, 7, false, ""}, // 7.4
+		{"partial with tax", paidOrder(1100, 100, 0, 0), 110, tax(10), 10, 110, 10, false, ""},
+		{"rest takes remaining tax", paidOrder(1100, 100, 330, 31), 770, nil, 69, 1100, 100, true, ""},
+		{"full at once", paidOrder(1100, 100, 0, 0), 1100, nil, 100, 1100, 100, true, ""},
+		{"exceeds remaining amount", paidOrder(1100, 100, 330, 30), 771, nil, 0, 0, 0, false, "amount"},
+		{"exceeds remaining tax", paidOrder(1100, 100, 330, 30), 100, tax(71), 0, 0, 0, false, "tax"},
+		{"exceeds remaining without tax", paidOrder(1100, 100, 100, 0), 950, tax(40), 0, 0, 0, false, "amount_without_tax"},
+		{"full refund needs remaining tax", paidOrder(1100, 100, 0, 0), 1100, tax(50), 0, 0, 0, false, "amount_without_tax"},
+		// 2*amount*taxがint64を超える金額でも按分できる(1e15 * 1e14 / 1.1e15)
+		{"partial prorated large amount", paidOrder(1_100_000_000_000_000, 100_000_000_000_000, 0, 0), 1_000_000_000_000_000, nil,
+			90_909_090_909_091, 1_000_000_000_000_000, 90_909_090_909_091, false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			refund, err := tt.order.Refund(NewMoney(tt.amount, "JPY"), tt.tax, "reason", time.Now())
+			if tt.wantExceeded != "" {
+				var exceeded *RefundExceededError
+				if !errors.As(err, &exceeded) || exceeded.Field != tt.wantExceeded {
+					t.Fatalf("error = %v, want RefundExceededError on %s", err, tt.wantExceeded)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Refund: %v", err)
+			}
+			if refund.Amount.Amount != tt.amount || refund.Tax.Amount != tt.wantTax {
+				t.Errorf("refund = (%v, %v), want (%d, %d)", refund.Amount, refund.Tax, tt.amount, tt.wantTax)
+			}
+			if tt.order.RefundedAmount.Amount != tt.wantRefunded || tt.order.RefundedTax.Amount != tt.wantRefTax {
+				t.Errorf("refunded = (%v, %v), want (%d, %d)", tt.order.RefundedAmount, tt.order.RefundedTax, tt.wantRefunded, tt.wantRefTax)
+			}
+			if got := tt.order.FullyRefunded(); got != tt.wantFull {
+				t.Errorf("FullyRefunded = %t, want %t", got, tt.wantFull)
+			}
+			if net := tt.order.NetAmount().Amount; net != 0 && tt.wantFull {
+				t.Errorf("NetAmount = %d after full refund", net)
+			}
+		})
+	}
+}
+
+func TestOrderRefundRejectsStatusAndCurrency(t *testing.T) {
+	pending := paidOrder(1100, 100, 0, 0)
+	pending.Status = OrderStatusPending
+	var transition *TransitionError
+	if _, err := pending.Refund(NewMoney(100, "JPY"), nil, "", time.Now()); !errors.As(err, &transition) {
+		t.Errorf("pending order: error = %v, want TransitionError", err)
+	}
+
+	var mismatch *CurrencyMismatchError
+	if _, err := paidOrder(1100, 100, 0, 0).Refund(NewMoney(100, "USD"), nil, "", time.Now()); !errors.As(err, &mismatch) {
+		t.Errorf("USD refund: error = %v, want CurrencyMismatchError", err)
+	}
+}
@@ -0,0 +1,26 @@
+package model
+
+import "time"
+
+// 消費税率。同じCodeでも適用期間ごとに別の行になる(例: 標準税率 8% → 10%)
+type TaxRate struct {
+	ID            int64      `gorm:"primaryKey" json:"id"`
+	Code          string     `gorm:"column:code" json:"code"`
+	Name          string     `gorm:"column:name" json:"name"`
+	Rate          int64      `gorm:"column:rate" json:"rate"`
+	EffectiveFrom time.Time  `gorm:"column:effective_from" json:"effective_from"`
+	EffectiveTo   *time.Time `gorm:"column:effective_to" json:"effective_to"`
+}
+
+const (
+	TaxRateCodeStandard = "standard" // 標準税率
+	TaxRateCodeReduced  = "reduced"  // 軽減税率
+)
+
+// atの時点で有効か(EffectiveFromを含み、EffectiveToを含まない)
+func (t *TaxRate) EffectiveAt(at time.Time) bool {
+	if at.Before(t.EffectiveFrom) {
+		return false
+	}
+	return t.EffectiveTo == nil || at.Before(*t.EffectiveTo)
+}
@@ -0,0 +1,87 @@
+package openapi
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gin-gonic/gin"
+)
+
+//go:embed openapi.yaml
+var spec []byte
+
+// 仕様書に載せるルートのプレフィックス
+var documentedPrefixes = []string{"/orders", "/users/", "/reports"}
+
+// Load 埋め込んだ仕様書を読み込んで検証する
+func Load() (*openapi3.T, error) {
+	doc, err := openapi3.NewLoader().LoadFromData(spec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load openapi spec: %w", err)
+	}
+	if err := doc.Validate(context.Background()); err != nil {
+		return nil, fmt.Errorf("invalid openapi spec: %w", err)
+	}
+	return doc, nil
+}
+
+// CheckRoutes 注文のルートと仕様書のpathsが一致しているか確認する。
+// ハンドラを追加して仕様書を更新し忘れた場合(またはその逆)に起動を止めるために使う
+func CheckRoutes(doc *openapi3.T, routes gin.RoutesInfo) error {
+	registered := map[string]bool{}
+	for _, route := range routes {
+		if !documented(route.Path) {
+			continue
+		}
+		registered[route.Method+" "+specPath(route.Path)] = true
+	}
+
+	documentedOps := map[string]bool{}
+	for path, item := range doc.Paths.Map() {
+		for method := range item.Operations() {
+			documentedOps[method+" "+path] = true
+		}
+	}
+
+	var missing, extra []string
+	for op := range registered {
+		if !documentedOps[op] {
+			missing = append(missing, op)
+		}
+	}
+	for op := range documentedOps {
+		if !registered[op] {
+			extra = append(extra, op)
+		}
+	}
+	if len(missing) == 0 && len(extra) == 0 {
+		return nil
+	}
+	slices.Sort(missing)
+	slices.Sort(extra)
+	return fmt.Errorf("openapi spec does not match routes: not documented %v, not routed %v", missing, extra)
+}
+
+func documented(path string) bool {
+	for _, prefix := range documentedPrefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+var ginParam = regexp.MustCompile(`:(\w+)`)
+
+// ginのルート(/orders/:id、/orders\:batch)をOpenAPIのパス(/orders/{id}、/orders:batch)にする
+func specPath(path string) string {
+	const escapedColon = "\x00"
+	path = strings.ReplaceAll(path, `\:`, escapedColon)
+	path = ginParam.ReplaceAllString(path, "{$1}")
+	return strings.ReplaceAll(path, escapedColon, ":")
+}
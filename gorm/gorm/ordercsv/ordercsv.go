@@ -0,0 +1,58 @@
+package ordercsv
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/makoto-developer/golang_examples/gorm/gorm/model"
+)
+
+// CSVの列(エクスポートの列順)
+var Header = []string{
+	"id",
+	"user_id",
+	"order_item_group_id",
+	"currency",
+	"amount",
+	"amount_without_tax",
+	"tax",
+	"refunded_amount",
+	"refunded_tax",
+	"tax_rate_id",
+	"status",
+	"version",
+	"created_at",
+	"updated_at",
+	"deleted_at",
+	"why_deleted",
+}
+
+// 注文をCSVの1行にする(日時はRFC3339、金額は通貨の最小単位)
+func Record(order *model.Order) []string {
+	deletedAt := ""
+	if order.DeletedAt.Valid {
+		deletedAt = formatTime(order.DeletedAt.Time)
+	}
+	return []string{
+		strconv.FormatInt(order.ID, 10),
+		strconv.FormatInt(order.UserID, 10),
+		strconv.FormatInt(order.OrderItemGroupID, 10),
+		string(order.Currency),
+		strconv.FormatInt(order.Amount.Amount, 10),
+		strconv.FormatInt(order.AmountWithoutTax.Amount, 10),
+		strconv.FormatInt(order.Tax.Amount, 10),
+		strconv.FormatInt(order.RefundedAmount.Amount, 10),
+		strconv.FormatInt(order.RefundedTax.Amount, 10),
+		strconv.FormatInt(order.TaxRateID, 10),
+		string(order.Status),
+		strconv.FormatInt(order.Version, 10),
+		formatTime(order.CreatedAt),
+		formatTime(order.UpdatedAt),
+		deletedAt,
+		order.WhyDeleted,
+	}
+}
+
+func formatTime(t time.Time) string {
+	return t.Format(time.RFC3339)
+}
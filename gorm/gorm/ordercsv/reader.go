@@ -0,0 +1,162 @@
+package ordercsv
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/makoto-developer/golang_examples/gorm/gorm/model"
+)
+
+// 取り込み時に注文へ設定する列
+var importColumns = map[string]bool{
+	"user_id":             true,
+	"order_item_group_id": true,
+	"currency":            true,
+	"amount":              true,
+	"amount_without_tax":  true,
+	"tax":                 true,
+	"tax_rate_id":         true,
+	"status":              true,
+	"created_at":          true,
+}
+
+// エクスポートには含まれるが、取り込み時はサーバ側で決めるので読み飛ばす列
+var ignoredColumns = map[string]bool{
+	"id":              true,
+	"refunded_amount": true,
+	"refunded_tax":    true,
+	"version":         true,
+	"updated_at":      true,
+	"deleted_at":      true,
+	"why_deleted":     true,
+}
+
+// Reader 1行目をヘッダーとしてCSVを注文に変換する
+type Reader struct {
+	r       *csv.Reader
+	columns []string
+}
+
+// NewReader ヘッダー行を読んで列を確認する
+func NewReader(r io.Reader) (*Reader, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("csv is empty")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid header: %w", err)
+	}
+
+	columns := make([]string, len(header))
+	seen := make(map[string]bool)
+	for i, name := range header {
+		// Excelで保存したCSVは先頭にBOMが付く
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if !importColumns[name] && !ignoredColumns[name] {
+			return nil, fmt.Errorf("unknown column: %s", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate column: %s", name)
+		}
+		seen[name] = true
+		columns[i] = name
+	}
+	if !seen["user_id"] {
+		return nil, errors.New("user_id column is required")
+	}
+	if !seen["amount"] && !seen["order_item_group_id"] {
+		return nil, errors.New("amount or order_item_group_id column is required")
+	}
+
+	cr.FieldsPerRecord = len(columns)
+	return &Reader{r: cr, columns: columns}, nil
+}
+
+// Read 次の行を注文にする。lineはその行の行番号(ヘッダーが1行目)。
+// 行の形式が不正な場合はエラーを返すが、続けて次の行を読める。最後まで読むとio.EOFを返す
+func (r *Reader) Read() (*model.Order, int, error) {
+	record, err := r.r.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, 0, io.EOF
+	}
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return nil, parseErr.StartLine, parseErr.Err
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	line, _ := r.r.FieldPos(0)
+
+	order := &model.Order{}
+	for i, value := range record {
+		if err := setColumn(order, r.columns[i], strings.TrimSpace(value)); err != nil {
+			return nil, line, err
+		}
+	}
+	// currency列が無い(空の)行は円
+	if order.Currency == "" {
+		order.Currency = model.DefaultCurrency
+	}
+	order.SetCurrency(order.Currency)
+	return order, line, nil
+}
+
+func setColumn(order *model.Order, column, value string) error {
+	if value == "" || ignoredColumns[column] {
+		return nil
+	}
+
+	if column == "created_at" {
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return fmt.Errorf("created_at must be RFC3339: %s", value)
+		}
+		order.CreatedAt = t.UTC()
+		return nil
+	}
+	if column == "status" {
+		status, err := model.ParseOrderStatus(value)
+		if err != nil {
+			return err
+		}
+		order.Status = status
+		return nil
+	}
+	if column == "currency" {
+		currency, err := model.ParseCurrency(value)
+		if err != nil {
+			return err
+		}
+		order.Currency = currency
+		return nil
+	}
+
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%s must be an integer: %s", column, value)
+	}
+	switch column {
+	case "user_id":
+		order.UserID = n
+	case "order_item_group_id":
+		order.OrderItemGroupID = n
+	case "amount":
+		order.Amount.Amount = n
+	case "amount_without_tax":
+		order.AmountWithoutTax.Amount = n
+	case "tax":
+		order.Tax.Amount = n
+	case "tax_rate_id":
+		order.TaxRateID = n
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package problem
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/makoto-developer/golang_examples/gorm/gorm/model"
+	"github.com/makoto-developer/golang_examples/gorm/gorm/repository"
+)
+
+// RFC 7807のメディアタイプ
+const ContentType = "application/problem+json"
+
+// エラーコード。クライアントはこの値で分岐するので、一度決めた値は変更しない
+const (
+	CodeBadRequest            = "bad_request"             // リクエストの形式が不正
+	CodeValidation            = "validation_failed"       // 入力値が不正(errorsに項目ごとの理由)
+	CodeInvalidCursor         = "invalid_cursor"          // ページングのcursorが不正
+	CodeUnauthorized          = "unauthorized"            // アクセストークンが無い・無効
+	CodeForbidden             = "forbidden"               // 権限が無い
+	CodeNotFound              = "not_found"               // 対象が存在しない
+	CodeConflict              = "conflict"                // 他のリクエストで先に更新された
+	CodeInvalidTransition     = "invalid_transition"      // 今の状態からは遷移できない
+	CodeRefundExceeded        = "refund_exceeded"         // 返金できる残りの金額を超えている
+	CodePreconditionFailed    = "precondition_failed"     // If-Matchが一致しない
+	CodePayloadTooLarge       = "payload_too_large"       // 件数が上限を超えている
+	CodeIdempotencyKeyReused  = "idempotency_key_reused"  // Idempotency-Keyが別のリクエストで使われている
+	CodeIdempotencyInProgress = "idempotency_in_progress" // 同じIdempotency-Keyのリクエストが処理中
+	CodeTimeout               = "timeout"                 // 処理が時間内に終わらなかった
+	CodeInternal              = "internal_error"          // サーバ側のエラー
+)
+
+// Problem application/problem+jsonのレスポンス
+type Problem struct {
+	Type     string                  `json:"type"`
+	Title    string                  `json:"title"`
+	Status   int                     `json:"status"`
+	Detail   string                  `json:"detail,omitempty"`
+	Instance string                  `json:"instance,omitempty"`
+	Code     string                  `json:"code"`
+	Errors   []repository.FieldError `json:"errors,omitempty"`
+}
+
+// Error ステータスとコードを指定したエラー(ハンドラやミドルウェアでリクエストを拒否するときに使う)
+type Error struct {
+	Status int
+	Code   string
+	Detail string
+}
+
+func (e *Error) Error() string {
+	return e.Detail
+}
+
+func New(status int, code, detail string) *Error {
+	return &Error{Status: status, Code: code, Detail: detail}
+}
+
+// BadRequest リクエストの形式が不正(400)
+func BadRequest(detail string) *Error {
+	return New(http.StatusBadRequest, CodeBadRequest, detail)
+}
+
+// Unauthorized アクセストークンが無い・無効(401)
+func Unauthorized(detail string) *Error {
+	return New(http.StatusUnauthorized, CodeUnauthorized, detail)
+}
+
+// Forbidden 権限が無い(403)
+func Forbidden(detail string) *Error {
+	return New(http.StatusForbidden, CodeForbidden, detail)
+}
+
+// NotFound 対象が存在しない(404)
+func NotFound(detail string) *Error {
+	return New(http.StatusNotFound, CodeNotFound, detail)
+}
+
+// From エラーをProblemにする。リポジトリのエラーはそれぞれのステータスとコードにし、それ以外は500にする
+func From(err error) *Problem {
+	var pe *Error
+	var ve *repository.ValidationError
+	var te *model.TransitionError
+	var re *model.RefundExceededError
+	switch {
+	case errors.As(err, &pe):
+		return newProblem(pe.Status, pe.Code, pe.Detail)
+	case errors.As(err, &ve):
+		p := newProblem(http.StatusBadRequest, CodeValidation, ve.Error())
+		p.Errors = ve.Fields
+		return p
+	case errors.Is(err, repository.ErrNotFound):
+		return newProblem(http.StatusNotFound, CodeNotFound, err.Error())
+	case errors.Is(err, repository.ErrConflict):
+		return newProblem(http.StatusConflict, CodeConflict, repository.ErrConflict.Error())
+	case errors.As(err, &te):
+		return newProblem(http.StatusConflict, CodeInvalidTransition, te.Error())
+	case errors.As(err, &re):
+		return newProblem(http.StatusConflict, CodeRefundExceeded, re.Error())
+	case errors.Is(err, repository.ErrInvalidCursor):
+		return newProblem(http.StatusBadRequest, CodeInvalidCursor, repository.ErrInvalidCursor.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return Timeout()
+	}
+	// サーバ内部のエラーの内容はクライアントに返さない
+	return newProblem(http.StatusInternalServerError, CodeInternal, "internal server error")
+}
+
+// Timeout リクエストの期限を過ぎた(504)
+func Timeout() *Problem {
+	return newProblem(http.StatusGatewayTimeout, CodeTimeout, "request timed out")
+}
+
+func newProblem(status int, code, detail string) *Problem {
+	return &Problem{
+		Type:   "/problems/" + strings.ReplaceAll(code, "_", "-"),
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
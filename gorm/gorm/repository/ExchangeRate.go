@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/makoto-developer/golang_examples/gorm/gorm/model"
+	"gorm.io/gorm"
+)
+
+type ExchangeRateRepository interface {
+	FindEffective(ctx context.Context, base, quote model.Currency, at time.Time) (*model.ExchangeRate, error)
+	List(ctx context.Context) ([]*model.ExchangeRate, error)
+}
+
+type exchangeRateRepository struct {
+	db *gorm.DB
+}
+
+func NewExchangeRateRepository(db *gorm.DB) ExchangeRateRepository {
+	return &exchangeRateRepository{db: db}
+}
+
+// baseからquoteへのatの時点に有効な為替レートを取得
+func (r *exchangeRateRepository) FindEffective(ctx context.Context, base, quote model.Currency, at time.Time) (*model.ExchangeRate, error) {
+	var rate model.ExchangeRate
+	result := r.db.WithContext(ctx).
+		Where("base_currency = ? AND quote_currency = ?", string(base), string(quote)).
+		Where("effective_from <= ? AND (effective_to IS NULL OR effective_to > ?)", at, at).
+		Order("effective_from DESC").
+		First(&rate)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to find effective exchange rate: %w", notFound(result.Error, fmt.Sprintf("%s/%s exchange rate at %s", base, quote, at.Format(time.DateOnly))))
+	}
+	return &rate, nil
+}
+
+// 為替レートを全て取得
+func (r *exchangeRateRepository) List(ctx context.Context) ([]*model.ExchangeRate, error) {
+	var rates []*model.ExchangeRate
+	result := r.db.WithContext(ctx).Order("base_currency, quote_currency, effective_from").Find(&rates)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to list exchange rates: %w", result.Error)
+	}
+	return rates, nil
+}
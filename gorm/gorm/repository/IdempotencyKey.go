@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/makoto-developer/golang_examples/gorm/gorm/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type IdempotencyKeyRepository interface {
+	Reserve(ctx context.Context, key, fingerprint string, expiresAt time.Time) (*model.IdempotencyKey, bool, error)
+	Complete(ctx context.Context, key string, statusCode int, responseBody []byte) error
+	Release(ctx context.Context, key string) error
+	DeleteExpired(ctx context.Context, now time.Time) (int64, error)
+}
+
+type idempotencyKeyRepository struct {
+	db *gorm.DB
+}
+
+func NewIdempotencyKeyRepository(db *gorm.DB) IdempotencyKeyRepository {
+	return &idempotencyKeyRepository{db: db}
+}
+
+// キーを処理中として登録する。既に登録済み(期限内)の場合は登録済みのレコードとfalseを返す
+func (r *idempotencyKeyRepository) Reserve(ctx context.Context, key, fingerprint string, expiresAt time.Time) (*model.IdempotencyKey, bool, error) {
+	record := model.IdempotencyKey{Key: key, Fingerprint: fingerprint, ExpiresAt: expiresAt.UTC()}
+	created := false
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// 期限切れのキーは再利用できる
+		if err := tx.Where("key = ? AND expires_at < ?", key, tx.NowFunc()).Delete(&model.IdempotencyKey{}).Error; err != nil {
+			return err
+		}
+
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&record)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 1 {
+			created = true
+			return nil
+		}
+		return tx.First(&record, "key = ?", key).Error
+	})
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to reserve idempotency key: %w", err)
+	}
+	return &record, created, nil
+}
+
+// 処理結果のレスポンスを保存する
+func (r *idempotencyKeyRepository) Complete(ctx context.Context, key string, statusCode int, responseBody []byte) error {
+	result := r.db.WithContext(ctx).Model(&model.IdempotencyKey{}).
+		Where("key = ?", key).
+		Updates(map[string]any{
+			"status_code":   statusCode,
+			"response_body": responseBody,
+		})
+	if result.Error != nil {
+		return fmt.Errorf("failed to complete idempotency key: %w", result.Error)
+	}
+	return nil
+}
+
+// 処理に失敗したキーを削除して、同じキーで再試行できるようにする
+func (r *idempotencyKeyRepository) Release(ctx context.Context, key string) error {
+	result := r.db.WithContext(ctx).Where("key = ?", key).Delete(&model.IdempotencyKey{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", result.Error)
+	}
+	return nil
+}
+
+// 期限切れのキーを削除する
+func (r *idempotencyKeyRepository) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).Where("expires_at < ?", now.UTC()).Delete(&model.IdempotencyKey{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to delete expired idempotency keys: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
@@ -1,19 +1,32 @@
 package repository
 
 import (
+	"context"
+	"errors"
 	"fmt"
 
 	"github.com/makoto-developer/golang_examples/gorm/gorm/model"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type OrderRepository interface {
-	Get(orderID uint64) *model.Order
-	ListByOrderID(orderIDs []uint64) ([]*model.Order, error)
-	ListByUserID(userID uint64) ([]*model.Order, error)
-	Create(order model.Order) error
-	Update(order model.Order) error
-	Delete(orderID uint64) error
+	Get(ctx context.Context, orderID uint64) (*model.Order, error)
+	GetWithItems(ctx context.Context, orderID uint64) (*model.Order, error)
+	GetItemGroup(ctx context.Context, groupID uint64) (*model.OrderItemGroup, error)
+	ListByOrderID(ctx context.Context, orderIDs []uint64) ([]*model.Order, error)
+	ListByUserID(ctx context.Context, userID uint64) ([]*model.Order, error)
+	List(ctx context.Context, filter OrderFilter, page Page) (*OrderPage, error)
+	Export(ctx context.Context, filter OrderFilter, fn func(order *model.Order) error) error
+	Create(ctx context.Context, order *model.Order) error
+	Update(ctx context.Context, order *model.Order) error
+	SaveBatch(ctx context.Context, creates []*model.Order, updates []*model.Order, batchSize int) error
+	Delete(ctx context.Context, orderID uint64, reason string) error
+	Restore(ctx context.Context, orderID uint64) (*model.Order, error)
+	Transition(ctx context.Context, orderID uint64, to model.OrderStatus, reason string) (*model.Order, error)
+	ListStatusTransitions(ctx context.Context, orderID uint64) ([]*model.OrderStatusTransition, error)
+	CreateRefund(ctx context.Context, orderID uint64, amount model.Money, tax *model.Money, reason string) (*model.Refund, *model.Order, error)
+	ListRefunds(ctx context.Context, orderID uint64) ([]*model.Refund, error)
 }
 
 type orderRepository struct {
@@ -24,20 +37,40 @@ func NewOrderRepository(db *gorm.DB) OrderRepository {
 	return &orderRepository{db: db}
 }
 
-// 注文IDで注文情報を取得
-func (r *orderRepository) Get(orderID uint64) *model.Order {
+// 注文IDで注文情報を取得(存在しなければErrNotFound)
+func (r *orderRepository) Get(ctx context.Context, orderID uint64) (*model.Order, error) {
 	var order model.Order
-	result := r.db.First(&order, orderID)
+	result := r.db.WithContext(ctx).Scopes(ownedOrders(ctx)).First(&order, orderID)
 	if result.Error != nil {
-		return nil
+		return nil, fmt.Errorf("failed to get order: %w", notFound(result.Error, fmt.Sprintf("order %d", orderID)))
 	}
-	return &order
+	return &order, nil
+}
+
+// 注文IDで注文情報を明細付きで取得
+func (r *orderRepository) GetWithItems(ctx context.Context, orderID uint64) (*model.Order, error) {
+	var order model.Order
+	result := r.db.WithContext(ctx).Scopes(ownedOrders(ctx)).Preload("OrderItemGroup.Items").First(&order, orderID)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to get order: %w", notFound(result.Error, fmt.Sprintf("order %d", orderID)))
+	}
+	return &order, nil
+}
+
+// 明細グループを明細付きで取得
+func (r *orderRepository) GetItemGroup(ctx context.Context, groupID uint64) (*model.OrderItemGroup, error) {
+	var group model.OrderItemGroup
+	result := r.db.WithContext(ctx).Scopes(ownedItemGroups(ctx)).Preload("Items").First(&group, groupID)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to get order item group: %w", notFound(result.Error, fmt.Sprintf("order item group %d", groupID)))
+	}
+	return &group, nil
 }
 
 // 注文IDで注文を検索
-func (r *orderRepository) ListByOrderID(orderIDs []uint64) ([]*model.Order, error) {
+func (r *orderRepository) ListByOrderID(ctx context.Context, orderIDs []uint64) ([]*model.Order, error) {
 	var orders []*model.Order
-	result := r.db.Where("id IN ?", orderIDs).Find(&orders)
+	result := r.db.WithContext(ctx).Scopes(ownedOrders(ctx)).Where("id IN ?", orderIDs).Find(&orders)
 	if result.Error != nil {
 		return nil, fmt.Errorf("failed to list orders by order ids: %w", result.Error)
 	}
@@ -45,41 +78,254 @@ func (r *orderRepository) ListByOrderID(orderIDs []uint64) ([]*model.Order, erro
 }
 
 // ユーザーIDで注文を全て取得
-func (r *orderRepository) ListByUserID(userID uint64) ([]*model.Order, error) {
+func (r *orderRepository) ListByUserID(ctx context.Context, userID uint64) ([]*model.Order, error) {
 	var orders []*model.Order
-	result := r.db.Where("user_id = ?", userID).Find(&orders)
+	result := r.db.WithContext(ctx).Scopes(ownedOrders(ctx)).Where("user_id = ?", userID).Find(&orders)
 	if result.Error != nil {
 		return nil, fmt.Errorf("failed to list orders by user id: %w", result.Error)
 	}
 	return orders, nil
 }
 
-// 新規注文を作成
-func (r *orderRepository) Create(order model.Order) error {
-	result := r.db.Create(&order)
+// 条件で絞り込んだ注文をキーセット(created_at,id)でページングして取得
+func (r *orderRepository) List(ctx context.Context, filter OrderFilter, page Page) (*OrderPage, error) {
+	page, after, err := page.normalize()
+	if err != nil {
+		return nil, err
+	}
+
+	query := filter.apply(r.db.WithContext(ctx).Model(&model.Order{}).Scopes(ownedOrders(ctx)))
+	if page.Sort == SortCreatedAtAsc {
+		if after != nil {
+			query = query.Where("(created_at, id) > (?, ?)", after.CreatedAt, after.ID)
+		}
+		query = query.Order("created_at ASC, id ASC")
+	} else {
+		if after != nil {
+			query = query.Where("(created_at, id) < (?, ?)", after.CreatedAt, after.ID)
+		}
+		query = query.Order("created_at DESC, id DESC")
+	}
+
+	// 1件多く取得して次ページの有無を判定する
+	var orders []*model.Order
+	result := query.Limit(page.Limit + 1).Find(&orders)
 	if result.Error != nil {
-		return fmt.Errorf("failed to create order: %w", result.Error)
+		return nil, fmt.Errorf("failed to list orders: %w", result.Error)
+	}
+
+	res := &OrderPage{Orders: orders}
+	if len(orders) > page.Limit {
+		res.Orders = orders[:page.Limit]
+		res.HasMore = true
+		last := res.Orders[len(res.Orders)-1]
+		res.NextCursor = encodeCursor(cursor{CreatedAt: last.CreatedAt, ID: last.ID, Sort: page.Sort})
+	}
+	return res, nil
+}
+
+// 新規注文を作成(OrderItemGroupが設定されていれば明細も同じトランザクションで作成)
+func (r *orderRepository) Create(ctx context.Context, order *model.Order) error {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if order.OrderItemGroup != nil {
+			if err := tx.Create(order.OrderItemGroup).Error; err != nil {
+				return err
+			}
+			order.OrderItemGroupID = order.OrderItemGroup.ID
+		}
+		order.Version = 1
+		if err := tx.Omit("OrderItemGroup").Create(order).Error; err != nil {
+			return err
+		}
+		return afterOrderChange(ctx, tx, model.OrderEventCreated, order.ID, nil, order)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create order: %w", err)
 	}
 	return nil
 }
 
-// 注文を編集
-func (r *orderRepository) Update(order model.Order) error {
-	result := r.db.Save(&order)
-	if result.Error != nil {
-		return fmt.Errorf("failed to update order: %w", result.Error)
+// 注文を編集。order.Versionが保存されているバージョンと一致する場合だけ更新し、バージョンを1増やす。
+// 一致しない場合はErrConflictを返す
+func (r *orderRepository) Update(ctx context.Context, order *model.Order) error {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return updateOrder(ctx, tx, order)
+	})
+	if errors.Is(err, ErrConflict) {
+		return ErrConflict
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update order: %w", err)
 	}
 	return nil
 }
 
-// 注文を削除(論理)
-func (r *orderRepository) Delete(orderID uint64) error {
-	result := r.db.Delete(&model.Order{}, orderID)
+// 複数の注文をまとめて作成・更新する。1つのトランザクションで実行し、1件でも失敗したら全て取り消す。
+// 作成はCreateInBatchesでbatchSize件ずつINSERTする
+func (r *orderRepository) SaveBatch(ctx context.Context, creates []*model.Order, updates []*model.Order, batchSize int) error {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if len(creates) > 0 {
+			var groups []*model.OrderItemGroup
+			for _, order := range creates {
+				if order.OrderItemGroup != nil {
+					groups = append(groups, order.OrderItemGroup)
+				}
+			}
+			if len(groups) > 0 {
+				if err := tx.CreateInBatches(groups, batchSize).Error; err != nil {
+					return err
+				}
+			}
+			for _, order := range creates {
+				if order.OrderItemGroup != nil {
+					order.OrderItemGroupID = order.OrderItemGroup.ID
+				}
+				order.Version = 1
+			}
+
+			if err := tx.Omit("OrderItemGroup").CreateInBatches(creates, batchSize).Error; err != nil {
+				return err
+			}
+			for _, order := range creates {
+				if err := afterOrderChange(ctx, tx, model.OrderEventCreated, order.ID, nil, order); err != nil {
+					return err
+				}
+			}
+		}
+
+		for _, order := range updates {
+			if err := updateOrder(ctx, tx, order); err != nil {
+				return fmt.Errorf("order %d: %w", order.ID, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save orders: %w", err)
+	}
+	return nil
+}
+
+// バージョンを確認して注文を更新する。トランザクション(tx)の中で呼ぶ
+func updateOrder(ctx context.Context, tx *gorm.DB, order *model.Order) error {
+	var before model.Order
+	if err := tx.Scopes(ownedOrders(ctx)).Clauses(clause.Locking{Strength: "UPDATE"}).First(&before, order.ID).Error; err != nil {
+		return notFound(err, fmt.Sprintf("order %d", order.ID))
+	}
+	if before.Version != order.Version {
+		return ErrConflict
+	}
+	// 返金済みの金額は注文の通貨で記録しているので、返金後は通貨を変えられず、金額も返金済みの金額より下げられない
+	if before.RefundedAmount.Amount > 0 {
+		if order.Currency != before.Currency {
+			return Invalid("currency", "cannot be changed after a refund")
+		}
+		if order.Amount.Amount < before.RefundedAmount.Amount {
+			return Invalid("amount", "cannot be less than the refunded amount (%d)", before.RefundedAmount.Amount)
+		}
+		if order.Tax.Amount < before.RefundedTax.Amount {
+			return Invalid("tax", "cannot be less than the refunded tax (%d)", before.RefundedTax.Amount)
+		}
+	}
+
+	result := tx.Model(&model.Order{}).
+		Where("id = ? AND version = ?", order.ID, order.Version).
+		Updates(map[string]any{
+			"order_item_group_id": order.OrderItemGroupID,
+			"user_id":             order.UserID,
+			"currency":            string(order.Currency),
+			"amount":              order.Amount,
+			"amount_without_tax":  order.AmountWithoutTax,
+			"tax":                 order.Tax,
+			"tax_rate_id":         order.TaxRateID,
+			"updated_at":          tx.NowFunc(),
+			"version":             gorm.Expr("version + 1"),
+		})
 	if result.Error != nil {
-		return fmt.Errorf("failed to delete order: %w", result.Error)
+		return result.Error
 	}
 	if result.RowsAffected == 0 {
-		return fmt.Errorf("order not found with id: %d", orderID)
+		return ErrConflict
+	}
+
+	var after model.Order
+	if err := tx.First(&after, order.ID).Error; err != nil {
+		return err
+	}
+	order.Version, order.UpdatedAt, order.Status = after.Version, after.UpdatedAt, after.Status
+	order.RefundedAmount, order.RefundedTax = after.RefundedAmount, after.RefundedTax
+	return afterOrderChange(ctx, tx, model.OrderEventUpdated, order.ID, &before, &after)
+}
+
+// 注文を削除(論理)。削除した理由も一緒に記録する
+func (r *orderRepository) Delete(ctx context.Context, orderID uint64, reason string) error {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var before model.Order
+		if err := tx.Scopes(ownedOrders(ctx)).Clauses(clause.Locking{Strength: "UPDATE"}).First(&before, orderID).Error; err != nil {
+			return notFound(err, fmt.Sprintf("order %d", orderID))
+		}
+
+		result := tx.Model(&model.Order{}).
+			Where("id = ?", orderID).
+			Updates(map[string]any{
+				"deleted_at":  tx.NowFunc(),
+				"why_deleted": reason,
+				"version":     gorm.Expr("version + 1"),
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+
+		var after model.Order
+		if err := tx.Unscoped().First(&after, orderID).Error; err != nil {
+			return err
+		}
+		return afterOrderChange(ctx, tx, model.OrderEventDeleted, before.ID, &before, &after)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete order: %w", err)
 	}
 	return nil
 }
+
+// 論理削除した注文を元に戻す
+func (r *orderRepository) Restore(ctx context.Context, orderID uint64) (*model.Order, error) {
+	var order model.Order
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var before model.Order
+		err := tx.Unscoped().Scopes(ownedOrders(ctx)).Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("deleted_at IS NOT NULL").
+			First(&before, orderID).Error
+		if err != nil {
+			return notFound(err, fmt.Sprintf("deleted order %d", orderID))
+		}
+
+		result := tx.Unscoped().Model(&model.Order{}).
+			Where("id = ?", orderID).
+			Updates(map[string]any{
+				"deleted_at":  nil,
+				"why_deleted": nil,
+				"version":     gorm.Expr("version + 1"),
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if err := tx.First(&order, orderID).Error; err != nil {
+			return err
+		}
+		return afterOrderChange(ctx, tx, model.OrderEventRestored, order.ID, &before, &order)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to restore order: %w", err)
+	}
+	return &order, nil
+}
+
+// 注文の変更に伴う書き込み(変更履歴とoutbox)。注文の変更と同じトランザクション(tx)で呼ぶ
+func afterOrderChange(ctx context.Context, tx *gorm.DB, eventType model.OrderEventType, orderID int64, before, after *model.Order) error {
+	if err := recordOrderEvent(ctx, tx, eventType, orderID, before, after); err != nil {
+		return err
+	}
+	return enqueueOrderMessage(ctx, tx, eventType, orderID, after)
+}
@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/makoto-developer/golang_examples/gorm/gorm/audit"
+	"github.com/makoto-developer/golang_examples/gorm/gorm/model"
+	"gorm.io/gorm"
+)
+
+type OrderEventRepository interface {
+	ListByOrderID(ctx context.Context, orderID uint64, until *time.Time) ([]*model.OrderEvent, error)
+}
+
+type orderEventRepository struct {
+	db *gorm.DB
+}
+
+func NewOrderEventRepository(db *gorm.DB) OrderEventRepository {
+	return &orderEventRepository{db: db}
+}
+
+// 注文の変更履歴を古い順に取得(untilを指定した場合はその日時までの履歴)
+func (r *orderEventRepository) ListByOrderID(ctx context.Context, orderID uint64, until *time.Time) ([]*model.OrderEvent, error) {
+	var events []*model.OrderEvent
+	query := r.db.WithContext(ctx).Scopes(ownedOrderEvents(ctx)).Where("order_id = ?", orderID)
+	if until != nil {
+		query = query.Where("created_at <= ?", until.UTC())
+	}
+	result := query.Order("id").Find(&events)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to list order events: %w", result.Error)
+	}
+	return events, nil
+}
+
+// 注文の変更履歴を書き込む。注文の変更と同じトランザクション(tx)で呼ぶ
+func recordOrderEvent(ctx context.Context, tx *gorm.DB, eventType model.OrderEventType, orderID int64, before, after *model.Order) error {
+	beforeJSON, beforeMap, err := snapshot(before)
+	if err != nil {
+		return err
+	}
+	afterJSON, afterMap, err := snapshot(after)
+	if err != nil {
+		return err
+	}
+	changes, err := json.Marshal(diff(beforeMap, afterMap))
+	if err != nil {
+		return err
+	}
+
+	event := model.OrderEvent{
+		OrderID:   orderID,
+		EventType: eventType,
+		Actor:     audit.ActorFrom(ctx),
+		RequestID: audit.RequestIDFrom(ctx),
+		Before:    beforeJSON,
+		After:     afterJSON,
+		Changes:   changes,
+	}
+	if err := tx.Create(&event).Error; err != nil {
+		return fmt.Errorf("failed to record order event: %w", err)
+	}
+	return nil
+}
+
+// 注文をJSONにしたもの(明細は含めない)
+func snapshot(order *model.Order) (model.JSON, map[string]any, error) {
+	if order == nil {
+		return nil, nil, nil
+	}
+	o := *order
+	o.OrderItemGroup = nil
+
+	b, err := json.Marshal(o)
+	if err != nil {
+		return nil, nil, err
+	}
+	var m map[string]any
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, nil, err
+	}
+	return b, m, nil
+}
+
+type change struct {
+	From any `json:"from"`
+	To   any `json:"to"`
+}
+
+// 変更前後で値が変わった項目
+func diff(before, after map[string]any) map[string]change {
+	changes := make(map[string]change)
+	for key, to := range after {
+		if from := before[key]; !reflect.DeepEqual(from, to) {
+			changes[key] = change{From: from, To: to}
+		}
+	}
+	for key, from := range before {
+		if _, ok := after[key]; !ok {
+			changes[key] = change{From: from, To: nil}
+		}
+	}
+	return changes
+}
@@ -0,0 +1,193 @@
+package repository
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/makoto-developer/golang_examples/gorm/gorm/model"
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultPageLimit = 50
+	MaxPageLimit     = 200
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// 並び順(created_at,idのキーセット)
+type SortOrder string
+
+const (
+	SortCreatedAtAsc  SortOrder = "created_at"
+	SortCreatedAtDesc SortOrder = "-created_at"
+)
+
+// ParseSortOrder クエリパラメータのsortを解釈する(空ならcreated_atの降順)
+func ParseSortOrder(s string) (SortOrder, error) {
+	switch SortOrder(s) {
+	case "":
+		return SortCreatedAtDesc, nil
+	case SortCreatedAtAsc, SortCreatedAtDesc:
+		return SortOrder(s), nil
+	}
+	return "", fmt.Errorf("unsupported sort: %s", s)
+}
+
+// 論理削除した注文を一覧に含めるか
+type DeletedScope string
+
+const (
+	DeletedExclude DeletedScope = ""     // 含めない(デフォルト)
+	DeletedInclude DeletedScope = "true" // 含める
+	DeletedOnly    DeletedScope = "only" // 削除済みのみ
+)
+
+// ParseDeletedScope クエリパラメータのinclude_deletedを解釈する
+func ParseDeletedScope(s string) (DeletedScope, error) {
+	switch DeletedScope(s) {
+	case "", "false":
+		return DeletedExclude, nil
+	case DeletedInclude, DeletedOnly:
+		return DeletedScope(s), nil
+	}
+	return "", fmt.Errorf("unsupported include_deleted: %s", s)
+}
+
+// 注文一覧の絞り込み条件(ゼロ値/nilの項目は条件に含めない)
+type OrderFilter struct {
+	Deleted          DeletedScope
+	UserID           uint64
+	OrderItemGroupID uint64
+	CreatedFrom      *time.Time // 以上(created_atと同じUTCにして比較する)
+	CreatedTo        *time.Time // 未満
+	Status           model.OrderStatus
+	Currency         model.Currency
+	AmountMin        *int64 // 通貨の最小単位(通貨の異なる注文も同じ数値で比較する)
+	AmountMax        *int64
+}
+
+// ページ指定。Cursorは前回のOrderPage.NextCursorをそのまま渡す
+type Page struct {
+	Limit  int
+	Cursor string
+	Sort   SortOrder
+}
+
+type OrderPage struct {
+	Orders     []*model.Order `json:"orders"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+	HasMore    bool           `json:"has_more"`
+}
+
+// 最後に返した行の位置。クライアントには不透明な文字列として渡す
+type cursor struct {
+	CreatedAt time.Time `json:"c"`
+	ID        int64     `json:"i"`
+	Sort      SortOrder `json:"s"`
+}
+
+func encodeCursor(c cursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string) (*cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c cursor
+	if err := json.Unmarshal(b, &c); err != nil || c.ID == 0 {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+func (f OrderFilter) apply(db *gorm.DB) *gorm.DB {
+	switch f.Deleted {
+	case DeletedInclude:
+		db = db.Unscoped()
+	case DeletedOnly:
+		db = db.Unscoped().Where("deleted_at IS NOT NULL")
+	}
+	if f.UserID != 0 {
+		db = db.Where("user_id = ?", f.UserID)
+	}
+	if f.OrderItemGroupID != 0 {
+		db = db.Where("order_item_group_id = ?", f.OrderItemGroupID)
+	}
+	if f.CreatedFrom != nil {
+		db = db.Where("created_at >= ?", f.CreatedFrom.UTC())
+	}
+	if f.CreatedTo != nil {
+		db = db.Where("created_at < ?", f.CreatedTo.UTC())
+	}
+	if f.Status != "" {
+		db = db.Where("status = ?", string(f.Status))
+	}
+	if f.Currency != "" {
+		db = db.Where("currency = ?", string(f.Currency))
+	}
+	if f.AmountMin != nil {
+		db = db.Where("amount >= ?", *f.AmountMin)
+	}
+	if f.AmountMax != nil {
+		db = db.Where("amount <= ?", *f.AmountMax)
+	}
+	return db
+}
+
+func (p Page) normalize() (Page, *cursor, error) {
+	if p.Limit <= 0 {
+		p.Limit = DefaultPageLimit
+	}
+	if p.Limit > MaxPageLimit {
+		p.Limit = MaxPageLimit
+	}
+	if p.Sort == "" {
+		p.Sort = SortCreatedAtDesc
+	}
+	if p.Cursor == "" {
+		return p, nil, nil
+	}
+	c, err := decodeCursor(p.Cursor)
+	if err != nil {
+		return p, nil, err
+	}
+	// 別の並び順で発行されたカーソルは位置の意味が変わるので受け付けない
+	if c.Sort != p.Sort {
+		return p, nil, ErrInvalidCursor
+	}
+	return p, c, nil
+}
+
+// 条件に合う注文を作成日時の古い順に1件ずつfnに渡す。
+// Rows()のカーソルで読むので全件をメモリに載せない。fnがエラーを返したらそこで止める
+func (r *orderRepository) Export(ctx context.Context, filter OrderFilter, fn func(order *model.Order) error) error {
+	rows, err := filter.apply(r.db.WithContext(ctx).Model(&model.Order{}).Scopes(ownedOrders(ctx))).
+		Order("created_at ASC, id ASC").
+		Rows()
+	if err != nil {
+		return fmt.Errorf("failed to export orders: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var order model.Order
+		if err := r.db.ScanRows(rows, &order); err != nil {
+			return fmt.Errorf("failed to scan order: %w", err)
+		}
+		if err := fn(&order); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to export orders: %w", err)
+	}
+	return nil
+}
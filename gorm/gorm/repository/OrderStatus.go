@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/makoto-developer/golang_examples/gorm/gorm/audit"
+	"github.com/makoto-developer/golang_examples/gorm/gorm/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 注文の状態をtoに遷移させて、遷移の記録(理由・日時・操作者)を書き込む。
+// 状態遷移表に無い遷移は*model.TransitionErrorを返す
+func (r *orderRepository) Transition(ctx context.Context, orderID uint64, to model.OrderStatus, reason string) (*model.Order, error) {
+	var order model.Order
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var before model.Order
+		if err := tx.Scopes(ownedOrders(ctx)).Clauses(clause.Locking{Strength: "UPDATE"}).First(&before, orderID).Error; err != nil {
+			return notFound(err, fmt.Sprintf("order %d", orderID))
+		}
+
+		now := tx.NowFunc()
+		current := before
+		transition, err := current.TransitionTo(to, reason, now)
+		if err != nil {
+			return err
+		}
+		transition.Actor = audit.ActorFrom(ctx)
+		transition.RequestID = audit.RequestIDFrom(ctx)
+
+		result := tx.Model(&model.Order{}).
+			Where("id = ?", orderID).
+			Updates(map[string]any{
+				"status":     string(to),
+				"updated_at": now,
+				"version":    gorm.Expr("version + 1"),
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if err := tx.Create(transition).Error; err != nil {
+			return fmt.Errorf("failed to record status transition: %w", err)
+		}
+
+		if err := tx.First(&order, orderID).Error; err != nil {
+			return err
+		}
+		return afterOrderChange(ctx, tx, model.StatusEventType(to), order.ID, &before, &order)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to transition order: %w", err)
+	}
+	return &order, nil
+}
+
+// 注文の状態遷移の記録を古い順に取得
+func (r *orderRepository) ListStatusTransitions(ctx context.Context, orderID uint64) ([]*model.OrderStatusTransition, error) {
+	var transitions []*model.OrderStatusTransition
+	result := r.db.WithContext(ctx).Scopes(ownedOrderEvents(ctx)).
+		Where("order_id = ?", orderID).
+		Order("id").
+		Find(&transitions)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to list status transitions: %w", result.Error)
+	}
+	return transitions, nil
+}
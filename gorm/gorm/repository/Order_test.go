@@ -0,0 +1,141 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	gormConfig "github.com/makoto-developer/golang_examples/gorm/config"
+	"github.com/makoto-developer/golang_examples/gorm/gorm/database"
+	"github.com/makoto-developer/golang_examples/gorm/gorm/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// メモリ上のSQLiteにテーブルと税率を作ったDB
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := database.Open(gormConfig.DatabaseConfig{Driver: "sqlite", Path: ":memory:"}, &gorm.Config{
+		Logger: logger.Discard,
+	})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			_ = sqlDB.Close()
+		}
+	})
+	return db
+}
+
+func yen(n int64) model.Money {
+	return model.NewMoney(n, "JPY")
+}
+
+func createTestOrder(t *testing.T, repo OrderRepository, userID int64) *model.Order {
+	t.Helper()
+	order := &model.Order{UserID: userID, Currency: "JPY", Amount: yen(1100), AmountWithoutTax: yen(1000), Tax: yen(100), TaxRateID: 3}
+	if err := repo.Create(context.Background(), order); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	return order
+}
+
+func TestOrderRepositoryCreateAndGet(t *testing.T) {
+	repo := NewOrderRepository(newTestDB(t))
+
+	order := &model.Order{
+		UserID:    100,
+		TaxRateID: 3,
+		OrderItemGroup: &model.OrderItemGroup{Items: []model.OrderItem{
+			{ProductID: 10, Quantity: 2, Currency: "JPY", UnitPrice: yen(500), TaxRateID: 3, TaxRate: 10},
+		}},
+		Currency: "JPY", Amount: yen(1100), AmountWithoutTax: yen(1000), Tax: yen(100),
+	}
+	if err := repo.Create(context.Background(), order); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if order.ID == 0 || order.OrderItemGroupID == 0 || order.Version != 1 {
+		t.Fatalf("created order = %+v, want id, group id and version 1", order)
+	}
+
+	got, err := repo.GetWithItems(context.Background(), uint64(order.ID))
+	if err != nil {
+		t.Fatalf("GetWithItems: %v", err)
+	}
+	if got.UserID != 100 || got.Amount != yen(1100) || got.AmountWithoutTax != yen(1000) || got.Tax != yen(100) {
+		t.Errorf("got = %+v, want the created values", got)
+	}
+	if got.OrderItemGroup == nil || len(got.OrderItemGroup.Items) != 1 || got.OrderItemGroup.Items[0].Subtotal() != yen(1000) {
+		t.Errorf("items = %+v, want 1 item with subtotal 1000", got.OrderItemGroup)
+	}
+	if got.CreatedAt.Location() != time.UTC || time.Since(got.CreatedAt) > time.Minute {
+		t.Errorf("created_at = %v, want the current time in UTC", got.CreatedAt)
+	}
+
+	if _, err := repo.Get(context.Background(), uint64(order.ID)+1); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get for an unknown id: error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestOrderRepositoryList(t *testing.T) {
+	repo := NewOrderRepository(newTestDB(t))
+	first := createTestOrder(t, repo, 100)
+	createTestOrder(t, repo, 200)
+	third := createTestOrder(t, repo, 100)
+
+	ctx := context.Background()
+	page, err := repo.List(ctx, OrderFilter{UserID: 100}, Page{Limit: 1, Sort: SortCreatedAtAsc})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(page.Orders) != 1 || page.Orders[0].ID != first.ID || !page.HasMore || page.NextCursor == "" {
+		t.Fatalf("first page = %+v, want order %d and a next cursor", page, first.ID)
+	}
+
+	page, err = repo.List(ctx, OrderFilter{UserID: 100}, Page{Limit: 1, Sort: SortCreatedAtAsc, Cursor: page.NextCursor})
+	if err != nil {
+		t.Fatalf("List (next page): %v", err)
+	}
+	if len(page.Orders) != 1 || page.Orders[0].ID != third.ID || page.HasMore {
+		t.Fatalf("second page = %+v, want only order %d", page, third.ID)
+	}
+}
+
+func TestOrderRepositoryDeleteAndRestore(t *testing.T) {
+	repo := NewOrderRepository(newTestDB(t))
+	order := createTestOrder(t, repo, 100)
+	id := uint64(order.ID)
+	ctx := context.Background()
+
+	if err := repo.Delete(ctx, id, "duplicate"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := repo.Get(ctx, id); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get for a deleted order: error = %v, want ErrNotFound", err)
+	}
+	page, err := repo.List(ctx, OrderFilter{Deleted: DeletedOnly}, Page{})
+	if err != nil {
+		t.Fatalf("List deleted: %v", err)
+	}
+	if len(page.Orders) != 1 || page.Orders[0].WhyDeleted != "duplicate" || !page.Orders[0].DeletedAt.Valid {
+		t.Fatalf("deleted orders = %+v, want the order with its reason", page.Orders)
+	}
+
+	restored, err := repo.Restore(ctx, id)
+	if err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if restored.DeletedAt.Valid || restored.WhyDeleted != "" || restored.Version != 3 {
+		t.Errorf("restored = %+v, want not deleted, no reason and version 3", restored)
+	}
+	if _, err := repo.Get(ctx, id); err != nil {
+		t.Errorf("Get for a restored order: %v", err)
+	}
+
+	if _, err := repo.Restore(ctx, id); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Restore for an order that is not deleted: error = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,152 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/makoto-developer/golang_examples/gorm/gorm/audit"
+	"github.com/makoto-developer/golang_examples/gorm/gorm/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type OutboxRepository interface {
+	ProcessPending(ctx context.Context, limit int, claimFor time.Duration, send func(msg *model.OutboxMessage) error) (int, error)
+}
+
+type outboxRepository struct {
+	db *gorm.DB
+}
+
+func NewOutboxRepository(db *gorm.DB) OutboxRepository {
+	return &outboxRepository{db: db}
+}
+
+// 未送信のメッセージを古い順にlimit件まで確保してsendに渡し、成功したものを送信済みにする。
+// 確保(claimed_untilの設定)は行ロック(SKIP LOCKED)を取った短いトランザクションで行い、コミットしてから送るので、
+// RabbitMQの応答を待つ間トランザクションを開いたままにしない。複数のrelayが同時に動いても確保中のメッセージは他のrelayが取らない。
+// relayが途中で落ちた場合も、claimFor(送り終わるまでの上限)を過ぎれば他のrelayが送り直す。
+// sendが失敗したらそこで止めて(順序を守るため)失敗回数とエラーを記録し、残りの確保を解除してそのエラーを返す
+func (r *outboxRepository) ProcessPending(ctx context.Context, limit int, claimFor time.Duration, send func(msg *model.OutboxMessage) error) (int, error) {
+	messages, err := r.claim(ctx, limit, claimFor)
+	if err != nil {
+		return 0, fmt.Errorf("failed to claim outbox messages: %w", err)
+	}
+
+	db := r.db.WithContext(ctx)
+	for i, msg := range messages {
+		if sendErr := send(msg); sendErr != nil {
+			// 失敗の記録と確保の解除は、送信を止めた原因がctxのキャンセルでも行う
+			record := r.db.WithContext(context.WithoutCancel(ctx))
+			err := record.Model(msg).Updates(map[string]any{
+				"attempts":      gorm.Expr("attempts + 1"),
+				"last_error":    sendErr.Error(),
+				"claimed_until": nil,
+			}).Error
+			if err == nil {
+				err = r.release(record, messages[i+1:])
+			}
+			if err != nil {
+				return i, fmt.Errorf("failed to record outbox failure: %w", err)
+			}
+			return i, fmt.Errorf("failed to send outbox message: %w", sendErr)
+		}
+		// ここで失敗した(RabbitMQには届いた)メッセージは確保の期限が切れた後にもう一度送られる
+		if err := db.Model(msg).Updates(map[string]any{"sent_at": db.NowFunc(), "claimed_until": nil}).Error; err != nil {
+			return i, fmt.Errorf("failed to mark outbox message as sent: %w", err)
+		}
+	}
+	return len(messages), nil
+}
+
+// 送るメッセージを確保する(他のrelayが確保中のものとロック中のものは飛ばす)
+func (r *outboxRepository) claim(ctx context.Context, limit int, claimFor time.Duration) ([]*model.OutboxMessage, error) {
+	var messages []*model.OutboxMessage
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := tx.NowFunc()
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("sent_at IS NULL AND (claimed_until IS NULL OR claimed_until < ?)", now).
+			Order("id").
+			Limit(limit).
+			Find(&messages)
+		if result.Error != nil || len(messages) == 0 {
+			return result.Error
+		}
+
+		ids := make([]int64, len(messages))
+		for i, msg := range messages {
+			ids[i] = msg.ID
+		}
+		return tx.Model(&model.OutboxMessage{}).Where("id IN ?", ids).Update("claimed_until", now.Add(claimFor)).Error
+	})
+	return messages, err
+}
+
+// 送らなかったメッセージの確保を解除して、次の送信ですぐに送れるようにする
+func (r *outboxRepository) release(db *gorm.DB, messages []*model.OutboxMessage) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	ids := make([]int64, len(messages))
+	for i, msg := range messages {
+		ids[i] = msg.ID
+	}
+	return db.Model(&model.OutboxMessage{}).Where("id IN ?", ids).Update("claimed_until", nil).Error
+}
+
+// メッセージの中身
+type orderMessage struct {
+	Type       string       `json:"type"`
+	OrderID    int64        `json:"order_id"`
+	OccurredAt time.Time    `json:"occurred_at"`
+	Actor      string       `json:"actor"`
+	RequestID  string       `json:"request_id"`
+	Order      *model.Order `json:"order"`
+}
+
+var orderMessageTypes = map[model.OrderEventType]string{
+	model.OrderEventCreated:           model.MessageOrderCreated,
+	model.OrderEventUpdated:           model.MessageOrderUpdated,
+	model.OrderEventDeleted:           model.MessageOrderDeleted,
+	model.OrderEventRestored:          model.MessageOrderRestored,
+	model.OrderEventPaid:              model.MessageOrderPaid,
+	model.OrderEventShipped:           model.MessageOrderShipped,
+	model.OrderEventCancelled:         model.MessageOrderCancelled,
+	model.OrderEventRefunded:          model.MessageOrderRefunded,
+	model.OrderEventPartiallyRefunded: model.MessageOrderPartiallyRefunded,
+}
+
+// 注文の変更をoutboxに書き込む。注文の変更と同じトランザクション(tx)で呼ぶ
+func enqueueOrderMessage(ctx context.Context, tx *gorm.DB, eventType model.OrderEventType, orderID int64, order *model.Order) error {
+	messageType, ok := orderMessageTypes[eventType]
+	if !ok {
+		return fmt.Errorf("no message type for order event: %s", eventType)
+	}
+
+	o := *order
+	o.OrderItemGroup = nil
+	payload, err := json.Marshal(orderMessage{
+		Type:       messageType,
+		OrderID:    orderID,
+		OccurredAt: time.Now(),
+		Actor:      audit.ActorFrom(ctx),
+		RequestID:  audit.RequestIDFrom(ctx),
+		Order:      &o,
+	})
+	if err != nil {
+		return err
+	}
+
+	msg := model.OutboxMessage{
+		AggregateType: "order",
+		AggregateID:   orderID,
+		MessageType:   messageType,
+		Payload:       payload,
+	}
+	if err := tx.Create(&msg).Error; err != nil {
+		return fmt.Errorf("failed to enqueue outbox message: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/makoto-developer/golang_examples/gorm/gorm/audit"
+	"github.com/makoto-developer/golang_examples/gorm/gorm/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 注文を返金して、返金の記録と返金済みの金額を書き込む。通貨を省略した金額は注文の通貨にする。
+// taxがnilなら返金額から按分する。残りを全て返金した場合は注文をrefundedに遷移させる。
+// 返金できる状態でなければ*model.TransitionError、残りを超える場合は*model.RefundExceededErrorを返す
+func (r *orderRepository) CreateRefund(ctx context.Context, orderID uint64, amount model.Money, tax *model.Money, reason string) (*model.Refund, *model.Order, error) {
+	var refund *model.Refund
+	var order model.Order
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var before model.Order
+		if err := tx.Scopes(ownedOrders(ctx)).Clauses(clause.Locking{Strength: "UPDATE"}).First(&before, orderID).Error; err != nil {
+			return notFound(err, fmt.Sprintf("order %d", orderID))
+		}
+
+		if amount.Currency == "" {
+			amount.Currency = before.Currency
+		}
+		if tax != nil && tax.Currency == "" {
+			t := model.NewMoney(tax.Amount, before.Currency)
+			tax = &t
+		}
+
+		now := tx.NowFunc()
+		current := before
+		var err error
+		if refund, err = current.Refund(amount, tax, reason, now); err != nil {
+			return err
+		}
+		refund.CreatedBy = audit.ActorFrom(ctx)
+		refund.RequestID = audit.RequestIDFrom(ctx)
+
+		updates := map[string]any{
+			"refunded_amount": current.RefundedAmount,
+			"refunded_tax":    current.RefundedTax,
+			"updated_at":      now,
+			"version":         gorm.Expr("version + 1"),
+		}
+		eventType := model.OrderEventPartiallyRefunded
+		if current.FullyRefunded() {
+			transition, err := current.TransitionTo(model.OrderStatusRefunded, reason, now)
+			if err != nil {
+				return err
+			}
+			transition.Actor = refund.CreatedBy
+			transition.RequestID = refund.RequestID
+			if err := tx.Create(transition).Error; err != nil {
+				return fmt.Errorf("failed to record status transition: %w", err)
+			}
+			updates["status"] = string(current.Status)
+			eventType = model.StatusEventType(current.Status)
+		}
+
+		if err := tx.Model(&model.Order{}).Where("id = ?", orderID).Updates(updates).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(refund).Error; err != nil {
+			return fmt.Errorf("failed to record refund: %w", err)
+		}
+
+		if err := tx.First(&order, orderID).Error; err != nil {
+			return err
+		}
+		return afterOrderChange(ctx, tx, eventType, order.ID, &before, &order)
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to refund order: %w", err)
+	}
+	return refund, &order, nil
+}
+
+// 注文の返金の記録を古い順に取得
+func (r *orderRepository) ListRefunds(ctx context.Context, orderID uint64) ([]*model.Refund, error) {
+	var refunds []*model.Refund
+	result := r.db.WithContext(ctx).Scopes(ownedOrderEvents(ctx)).
+		Where("order_id = ?", orderID).
+		Order("id").
+		Find(&refunds)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to list refunds: %w", result.Error)
+	}
+	return refunds, nil
+}
@@ -0,0 +1,351 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/makoto-developer/golang_examples/gorm/gorm/model"
+	"gorm.io/gorm"
+)
+
+// 集計の期間の単位
+type ReportPeriod string
+
+const (
+	PeriodDay   ReportPeriod = "day"
+	PeriodWeek  ReportPeriod = "week" // 月曜始まり
+	PeriodMonth ReportPeriod = "month"
+)
+
+// ParseReportPeriod クエリパラメータのperiodを解釈する(空ならday)
+func ParseReportPeriod(s string) (ReportPeriod, error) {
+	switch ReportPeriod(s) {
+	case "":
+		return PeriodDay, nil
+	case PeriodDay, PeriodWeek, PeriodMonth:
+		return ReportPeriod(s), nil
+	}
+	return "", fmt.Errorf("unsupported period: %s", s)
+}
+
+// 期間に加えて集計を分ける項目
+type ReportGroupBy string
+
+const (
+	GroupByNone    ReportGroupBy = ""
+	GroupByUser    ReportGroupBy = "user"
+	GroupByTaxRate ReportGroupBy = "tax_rate"
+)
+
+// ParseReportGroupBy クエリパラメータのgroup_byを解釈する
+func ParseReportGroupBy(s string) (ReportGroupBy, error) {
+	switch ReportGroupBy(s) {
+	case GroupByNone, GroupByUser, GroupByTaxRate:
+		return ReportGroupBy(s), nil
+	}
+	return "", fmt.Errorf("unsupported group_by: %s", s)
+}
+
+// 売上集計の条件
+type SalesQuery struct {
+	Period         ReportPeriod
+	GroupBy        ReportGroupBy
+	Location       *time.Location // 期間の区切りに使うタイムゾーン
+	From           *time.Time     // 以上
+	To             *time.Time     // 未満
+	UserID         uint64
+	IncludeDeleted bool
+	// 換算先の通貨。空なら通貨ごとに集計し、指定すると注文日のレートで換算して合算する
+	Currency model.Currency
+	// 集計する注文の状態。空ならDefaultSalesStatuses
+	Statuses []model.OrderStatus
+}
+
+// 売上として集計する注文の状態(支払い待ちとキャンセルは含めない。返金済みは返金を差し引いて0になる)
+var DefaultSalesStatuses = []model.OrderStatus{model.OrderStatusPaid, model.OrderStatusShipped, model.OrderStatusRefunded}
+
+// ParseSalesStatuses クエリパラメータのstatus(カンマ区切り)を解釈する(空ならDefaultSalesStatuses)
+func ParseSalesStatuses(s string) ([]model.OrderStatus, error) {
+	if strings.TrimSpace(s) == "" {
+		return DefaultSalesStatuses, nil
+	}
+	var statuses []model.OrderStatus
+	for _, v := range strings.Split(s, ",") {
+		status, err := model.ParseOrderStatus(strings.TrimSpace(v))
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// 期間(とgroup_by)・通貨ごとの集計結果。金額はCurrencyの最小単位で、返金を差し引いた金額
+type SalesRow struct {
+	PeriodStart      string         `json:"period_start"` // Locationでの期間の初日(YYYY-MM-DD)
+	UserID           *int64         `json:"user_id,omitempty"`
+	TaxRateID        *int64         `json:"tax_rate_id,omitempty"`
+	Currency         model.Currency `json:"currency"`
+	OrderCount       int64          `json:"order_count"`
+	Amount           int64          `json:"amount"`
+	AmountWithoutTax int64          `json:"amount_without_tax"`
+	Tax              int64          `json:"tax"`
+	RefundedAmount   int64          `json:"refunded_amount"` // 差し引いた返金額(税込)
+	AverageAmount    float64        `json:"average_amount"`
+	Formatted        SalesFormatted `gorm:"-" json:"formatted"`
+}
+
+// 集計結果の金額を通貨の記号・桁区切り付きで表示したもの(例: ¥1,100 / $12.34)
+type SalesFormatted struct {
+	Amount           string `json:"amount"`
+	AmountWithoutTax string `json:"amount_without_tax"`
+	Tax              string `json:"tax"`
+	RefundedAmount   string `json:"refunded_amount"`
+	AverageAmount    string `json:"average_amount"`
+}
+
+// SQLで集計した行(換算する場合は注文日ごと)
+type salesAggregate struct {
+	SalesRow
+	Day string // Locationでの注文日(YYYY-MM-DD)
+}
+
+// 複数の税率の明細がある注文のIDを、エラーに何件まで含めるか
+const mixedTaxRateLimit = 10
+
+// 注文の税率ID。明細のある注文は明細の税率にする(明細で税率を指定すると注文のtax_rate_idと異なることがある)
+const orderTaxRateExpr = "COALESCE((SELECT MIN(order_items.tax_rate_id) FROM order_items" +
+	" WHERE order_items.order_item_group_id = orders.order_item_group_id), orders.tax_rate_id)"
+
+type ReportRepository interface {
+	Sales(ctx context.Context, q SalesQuery) ([]*SalesRow, error)
+}
+
+type reportRepository struct {
+	db *gorm.DB
+}
+
+func NewReportRepository(db *gorm.DB) ReportRepository {
+	return &reportRepository{db: db}
+}
+
+// 注文の売上(返金を差し引いた金額)を期間ごとにSQLのGROUP BYで集計する。返金は注文の期間に含める。
+// 換算先の通貨を指定した場合は注文日ごとに集計してから、その日に有効な為替レートで換算して合算する
+func (r *reportRepository) Sales(ctx context.Context, q SalesQuery) ([]*SalesRow, error) {
+	loc := q.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	period, args := periodExpr(r.db.Dialector.Name(), q.Period, loc)
+
+	selects := []string{period + " AS period_start"}
+	groups := []string{"period_start"}
+	switch q.GroupBy {
+	case GroupByUser:
+		selects = append(selects, "user_id")
+		groups = append(groups, "user_id")
+	case GroupByTaxRate:
+		selects = append(selects, orderTaxRateExpr+" AS tax_rate_id")
+		// PostgreSQLのGROUP BYは別名よりordersのカラムを優先するので式で指定する
+		groups = append(groups, orderTaxRateExpr)
+	}
+	selects = append(selects, "currency")
+	groups = append(groups, "currency")
+	if q.Currency != "" {
+		day, dayArgs := periodExpr(r.db.Dialector.Name(), PeriodDay, loc)
+		selects = append(selects, day+" AS day")
+		groups = append(groups, "day")
+		args = append(args, dayArgs...)
+	}
+	selects = append(selects,
+		"COUNT(*) AS order_count",
+		"COALESCE(SUM(amount - refunded_amount), 0) AS amount",
+		"COALESCE(SUM(amount_without_tax - (refunded_amount - refunded_tax)), 0) AS amount_without_tax",
+		"COALESCE(SUM(tax - refunded_tax), 0) AS tax",
+		"COALESCE(SUM(refunded_amount), 0) AS refunded_amount",
+	)
+
+	db := r.db.WithContext(ctx).Model(&model.Order{})
+	if q.IncludeDeleted {
+		db = db.Unscoped()
+	}
+	statuses := q.Statuses
+	if len(statuses) == 0 {
+		statuses = DefaultSalesStatuses
+	}
+	db = db.Where("status IN ?", statuses)
+	if q.UserID != 0 {
+		db = db.Where("user_id = ?", q.UserID)
+	}
+	if q.From != nil {
+		db = db.Where("created_at >= ?", q.From.UTC())
+	}
+	if q.To != nil {
+		db = db.Where("created_at < ?", q.To.UTC())
+	}
+
+	if q.GroupBy == GroupByTaxRate {
+		var mixed []int64
+		multiRate := r.db.Model(&model.OrderItem{}).
+			Select("order_item_group_id").
+			Group("order_item_group_id").
+			Having("COUNT(DISTINCT tax_rate_id) > 1")
+		err := db.Session(&gorm.Session{}).
+			Where("order_item_group_id IN (?)", multiRate).
+			Order("id").
+			Limit(mixedTaxRateLimit).
+			Pluck("id", &mixed).Error
+		if err != nil {
+			return nil, fmt.Errorf("failed to check tax rates of orders: %w", err)
+		}
+		if len(mixed) > 0 {
+			// 注文の金額は税率ごとに分けて保存していないので、税率ごとには集計できない
+			return nil, Invalid("group_by", "tax_rate cannot be used for orders with items at multiple tax rates (order ids: %v)", mixed)
+		}
+	}
+
+	var aggregates []*salesAggregate
+	result := db.
+		Select(strings.Join(selects, ", "), args...).
+		Group(strings.Join(groups, ", ")).
+		Order(strings.Join(groups, ", ")).
+		Scan(&aggregates)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to aggregate sales: %w", result.Error)
+	}
+
+	if q.Currency != "" {
+		converter := &rateConverter{repo: NewExchangeRateRepository(r.db)}
+		for _, a := range aggregates {
+			if err := converter.convert(ctx, a, q.Currency, loc); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return mergeSales(aggregates), nil
+}
+
+// 期間(とgroup_by)・通貨が同じ行を合算して、平均と表示用の金額を設定する(行の順番は変えない)
+func mergeSales(aggregates []*salesAggregate) []*SalesRow {
+	type key struct {
+		period    string
+		userID    int64
+		taxRateID int64
+		currency  model.Currency
+	}
+	var rows []*SalesRow
+	merged := make(map[key]*SalesRow)
+	for _, a := range aggregates {
+		k := key{period: a.PeriodStart, currency: a.Currency}
+		if a.UserID != nil {
+			k.userID = *a.UserID
+		}
+		if a.TaxRateID != nil {
+			k.taxRateID = *a.TaxRateID
+		}
+		row, ok := merged[k]
+		if !ok {
+			row = &SalesRow{PeriodStart: a.PeriodStart, UserID: a.UserID, TaxRateID: a.TaxRateID, Currency: a.Currency}
+			merged[k] = row
+			rows = append(rows, row)
+		}
+		row.OrderCount += a.OrderCount
+		row.Amount += a.Amount
+		row.AmountWithoutTax += a.AmountWithoutTax
+		row.Tax += a.Tax
+		row.RefundedAmount += a.RefundedAmount
+	}
+
+	for _, row := range rows {
+		if row.OrderCount > 0 {
+			row.AverageAmount = math.Round(float64(row.Amount)/float64(row.OrderCount)*100) / 100
+		}
+		row.Formatted = SalesFormatted{
+			Amount:           model.NewMoney(row.Amount, row.Currency).Format(),
+			AmountWithoutTax: model.NewMoney(row.AmountWithoutTax, row.Currency).Format(),
+			Tax:              model.NewMoney(row.Tax, row.Currency).Format(),
+			RefundedAmount:   model.NewMoney(row.RefundedAmount, row.Currency).Format(),
+			AverageAmount:    model.NewMoney(int64(math.Round(row.AverageAmount)), row.Currency).Format(),
+		}
+	}
+	return rows
+}
+
+// 集計した行を為替レートで換算する(一度取得したレートは適用期間内の日付に使い回す)
+type rateConverter struct {
+	repo  ExchangeRateRepository
+	rates []*model.ExchangeRate
+}
+
+// 行の金額をtoに換算する。税抜金額と消費税をそれぞれ換算し、税込金額はその合計にする(返金額はそのまま換算する)
+func (c *rateConverter) convert(ctx context.Context, a *salesAggregate, to model.Currency, loc *time.Location) error {
+	if a.Currency == to {
+		return nil
+	}
+	day, err := time.ParseInLocation(time.DateOnly, a.Day, loc)
+	if err != nil {
+		return fmt.Errorf("failed to parse aggregated day %q: %w", a.Day, err)
+	}
+	rate, err := c.find(ctx, a.Currency, to, day)
+	if errors.Is(err, ErrNotFound) {
+		return Invalid("currency", "no exchange rate from %s to %s at %s", a.Currency, to, a.Day)
+	}
+	if err != nil {
+		return err
+	}
+
+	amountWithoutTax, err := rate.Convert(model.NewMoney(a.AmountWithoutTax, a.Currency))
+	if err != nil {
+		return err
+	}
+	tax, err := rate.Convert(model.NewMoney(a.Tax, a.Currency))
+	if err != nil {
+		return err
+	}
+	refunded, err := rate.Convert(model.NewMoney(a.RefundedAmount, a.Currency))
+	if err != nil {
+		return err
+	}
+	a.Currency = to
+	a.AmountWithoutTax, a.Tax, a.RefundedAmount = amountWithoutTax.Amount, tax.Amount, refunded.Amount
+	a.Amount = a.AmountWithoutTax + a.Tax
+	return nil
+}
+
+func (c *rateConverter) find(ctx context.Context, from, to model.Currency, at time.Time) (*model.ExchangeRate, error) {
+	for _, rate := range c.rates {
+		if rate.BaseCurrency == from && rate.QuoteCurrency == to && rate.EffectiveAt(at) {
+			return rate, nil
+		}
+	}
+	rate, err := c.repo.FindEffective(ctx, from, to, at)
+	if err != nil {
+		return nil, err
+	}
+	c.rates = append(c.rates, rate)
+	return rate, nil
+}
+
+// created_atをlocの日時に変換して、期間の初日(YYYY-MM-DD)にするSQL
+func periodExpr(dialect string, period ReportPeriod, loc *time.Location) (string, []any) {
+	if dialect == "sqlite" {
+		// SQLiteはタイムゾーンを扱えないので、現在のUTCとの時差をずらす(サマータイムの切り替えは考慮しない)
+		_, offset := time.Now().In(loc).Zone()
+		shift := fmt.Sprintf("%+d seconds", offset)
+		switch period {
+		case PeriodWeek:
+			return "date(created_at, ?, 'weekday 0', '-6 days')", []any{shift}
+		case PeriodMonth:
+			return "strftime('%Y-%m-01', created_at, ?)", []any{shift}
+		}
+		return "date(created_at, ?)", []any{shift}
+	}
+
+	// PostgreSQLのcreated_atはタイムゾーン無しのUTCなので、一度UTCとして解釈してからlocの日時に変換する
+	return "to_char(date_trunc(?, (created_at AT TIME ZONE 'UTC') AT TIME ZONE ?), 'YYYY-MM-DD')",
+		[]any{string(period), loc.String()}
+}
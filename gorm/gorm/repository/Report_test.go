@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/makoto-developer/golang_examples/gorm/gorm/model"
+)
+
+func TestReportSalesByTaxRate(t *testing.T) {
+	db := newTestDB(t)
+	orders := NewOrderRepository(db)
+	reports := NewReportRepository(db)
+	ctx := context.Background()
+
+	// 明細で軽減税率(4)を指定した注文は、注文のtax_rate_id(3)ではなく明細の税率で集計する
+	reduced := &model.Order{
+		UserID:    100,
+		TaxRateID: 3,
+		OrderItemGroup: &model.OrderItemGroup{Items: []model.OrderItem{
+			{ProductID: 10, Quantity: 1, Currency: "JPY", UnitPrice: yen(1000), TaxRateID: 4, TaxRate: 8},
+		}},
+		Currency: "JPY", Amount: yen(1080), AmountWithoutTax: yen(1000), Tax: yen(80),
+	}
+	if err := orders.Create(ctx, reduced); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	createTestOrder(t, orders, 100) // 明細なし、標準税率(3)
+
+	// 作成した注文は支払い待ちなので、デフォルトでは集計しない
+	rows, err := reports.Sales(ctx, SalesQuery{Period: PeriodDay})
+	if err != nil {
+		t.Fatalf("Sales: %v", err)
+	}
+	if len(rows) != 0 {
+		t.Fatalf("rows = %+v, want no rows for pending orders", rows)
+	}
+
+	pending := []model.OrderStatus{model.OrderStatusPending}
+	rows, err = reports.Sales(ctx, SalesQuery{Period: PeriodDay, GroupBy: GroupByTaxRate, Statuses: pending})
+	if err != nil {
+		t.Fatalf("Sales: %v", err)
+	}
+	got := map[int64]int64{}
+	for _, row := range rows {
+		if row.TaxRateID == nil {
+			t.Fatalf("row without tax_rate_id: %+v", row)
+		}
+		got[*row.TaxRateID] += row.Tax
+	}
+	if len(got) != 2 || got[3] != 100 || got[4] != 80 {
+		t.Errorf("tax by tax_rate_id = %v, want map[3:100 4:80]", got)
+	}
+
+	mixed := &model.Order{
+		UserID:    100,
+		TaxRateID: 3,
+		OrderItemGroup: &model.OrderItemGroup{Items: []model.OrderItem{
+			{ProductID: 10, Quantity: 1, Currency: "JPY", UnitPrice: yen(1000), TaxRateID: 3, TaxRate: 10},
+			{ProductID: 20, Quantity: 1, Currency: "JPY", UnitPrice: yen(1000), TaxRateID: 4, TaxRate: 8},
+		}},
+		Currency: "JPY", Amount: yen(2180), AmountWithoutTax: yen(2000), Tax: yen(180),
+	}
+	if err := orders.Create(ctx, mixed); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	_, err = reports.Sales(ctx, SalesQuery{Period: PeriodDay, GroupBy: GroupByTaxRate, Statuses: pending})
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) || validationErr.Fields[0].Field != "group_by" ||
+		!strings.Contains(err.Error(), fmt.Sprintf("[%d]", mixed.ID)) {
+		t.Fatalf("Sales error = %v, want a group_by validation error for order %d", err, mixed.ID)
+	}
+
+	// 税率で分けない集計は複数の税率の注文も含める
+	rows, err = reports.Sales(ctx, SalesQuery{Period: PeriodDay, Statuses: pending})
+	if err != nil {
+		t.Fatalf("Sales: %v", err)
+	}
+	if len(rows) != 1 || rows[0].OrderCount != 3 || rows[0].Tax != 360 {
+		t.Errorf("rows = %+v, want 1 row with 3 orders and tax 360", rows)
+	}
+}
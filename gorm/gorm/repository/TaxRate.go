@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/makoto-developer/golang_examples/gorm/gorm/model"
+	"gorm.io/gorm"
+)
+
+type TaxRateRepository interface {
+	Get(ctx context.Context, taxRateID uint64) (*model.TaxRate, error)
+	FindEffective(ctx context.Context, code string, at time.Time) (*model.TaxRate, error)
+	List(ctx context.Context) ([]*model.TaxRate, error)
+}
+
+type taxRateRepository struct {
+	db *gorm.DB
+}
+
+func NewTaxRateRepository(db *gorm.DB) TaxRateRepository {
+	return &taxRateRepository{db: db}
+}
+
+// 税率IDで税率を取得
+func (r *taxRateRepository) Get(ctx context.Context, taxRateID uint64) (*model.TaxRate, error) {
+	var rate model.TaxRate
+	result := r.db.WithContext(ctx).First(&rate, taxRateID)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to get tax rate: %w", notFound(result.Error, fmt.Sprintf("tax rate %d", taxRateID)))
+	}
+	return &rate, nil
+}
+
+// 税率の種類(code)でatの時点に有効な税率を取得
+func (r *taxRateRepository) FindEffective(ctx context.Context, code string, at time.Time) (*model.TaxRate, error) {
+	var rate model.TaxRate
+	// 適用期間はUTCで保存している
+	at = at.UTC()
+	result := r.db.WithContext(ctx).
+		Where("code = ? AND effective_from <= ? AND (effective_to IS NULL OR effective_to > ?)", code, at, at).
+		Order("effective_from DESC").
+		First(&rate)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to find effective tax rate: %w", notFound(result.Error, fmt.Sprintf("%s tax rate at %s", code, at.Format(time.DateOnly))))
+	}
+	return &rate, nil
+}
+
+// 税率を全て取得
+func (r *taxRateRepository) List(ctx context.Context) ([]*model.TaxRate, error) {
+	var rates []*model.TaxRate
+	result := r.db.WithContext(ctx).Order("code, effective_from").Find(&rates)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to list tax rates: %w", result.Error)
+	}
+	return rates, nil
+}
@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// 対象のレコードが存在しない(論理削除済みを含む)
+	ErrNotFound = errors.New("not found")
+	// 更新しようとした注文が他のリクエストで先に更新されていた(バージョン不一致)
+	ErrConflict = errors.New("order was modified by another request")
+	// 入力値が不正。詳細は*ValidationErrorで取得できる
+	ErrValidation = errors.New("validation failed")
+)
+
+// 項目ごとの検証エラー
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError 入力値の検証エラー(errors.Is(err, ErrValidation)で判定できる)
+type ValidationError struct {
+	Fields []FieldError
+}
+
+// Invalid 1項目の検証エラーを作る(例: Invalid("user_id", "is required"))
+func Invalid(field, format string, args ...any) *ValidationError {
+	return &ValidationError{Fields: []FieldError{{Field: field, Message: fmt.Sprintf(format, args...)}}}
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		msgs[i] = f.Field + " " + f.Message
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrValidation
+}
+
+// WithPrefix 項目名の前にprefixを付ける(例: items[0]. + product_id)。検証エラー以外はそのまま返す
+func WithPrefix(err error, prefix string) error {
+	var ve *ValidationError
+	if !errors.As(err, &ve) {
+		return err
+	}
+	fields := make([]FieldError, len(ve.Fields))
+	for i, f := range ve.Fields {
+		fields[i] = FieldError{Field: prefix + f.Field, Message: f.Message}
+	}
+	return &ValidationError{Fields: fields}
+}
+
+// gormのErrRecordNotFoundをErrNotFoundにする(what: "order 1"など対象の説明)
+func notFound(err error, what string) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("%s: %w", what, ErrNotFound)
+	}
+	return err
+}
@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/makoto-developer/golang_examples/gorm/gorm/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type ownerKey struct{}
+
+// WithOwner 以降の注文の取得・更新・削除をuserIDの注文に限定する(管理者以外のリクエスト)。
+// 他のユーザーの注文は存在しないものとして扱う(ErrNotFound)
+func WithOwner(ctx context.Context, userID uint64) context.Context {
+	return context.WithValue(ctx, ownerKey{}, userID)
+}
+
+// OwnerFrom WithOwnerで限定したユーザー(限定していなければfalse)
+func OwnerFrom(ctx context.Context) (uint64, bool) {
+	userID, ok := ctx.Value(ownerKey{}).(uint64)
+	return userID, ok
+}
+
+// 注文のクエリをWithOwnerのユーザーの注文に絞り込むスコープ
+func ownedOrders(ctx context.Context) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		userID, ok := OwnerFrom(ctx)
+		if !ok {
+			return db
+		}
+		return db.Where(clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: "user_id"}, Value: userID})
+	}
+}
+
+// 明細グループのクエリを、WithOwnerのユーザーの注文(論理削除済みを含む)が使っているものに絞り込むスコープ
+func ownedItemGroups(ctx context.Context) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		userID, ok := OwnerFrom(ctx)
+		if !ok {
+			return db
+		}
+		orders := db.Session(&gorm.Session{NewDB: true}).Unscoped().
+			Model(&model.Order{}).Select("order_item_group_id").Where("user_id = ?", userID)
+		return db.Where("id IN (?)", orders)
+	}
+}
+
+// 変更履歴・状態遷移・返金のクエリをWithOwnerのユーザーの注文(論理削除済みを含む)のものに絞り込むスコープ
+func ownedOrderEvents(ctx context.Context) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		userID, ok := OwnerFrom(ctx)
+		if !ok {
+			return db
+		}
+		orders := db.Session(&gorm.Session{NewDB: true}).Unscoped().
+			Model(&model.Order{}).Select("id").Where("user_id = ?", userID)
+		return db.Where("order_id IN (?)", orders)
+	}
+}
@@ -0,0 +1,134 @@
+package tax
+
+import (
+	"fmt"
+
+	"github.com/makoto-developer/golang_examples/gorm/gorm/model"
+)
+
+// 消費税の端数処理
+type RoundingMode string
+
+const (
+	RoundingFloor  RoundingMode = "floor"   // 切り捨て
+	RoundingCeil   RoundingMode = "ceil"    // 切り上げ
+	RoundingHalfUp RoundingMode = "half_up" // 四捨五入
+)
+
+// ParseRoundingMode 設定値から端数処理を解釈する(空なら切り捨て)
+func ParseRoundingMode(s string) (RoundingMode, error) {
+	switch RoundingMode(s) {
+	case "":
+		return RoundingFloor, nil
+	case RoundingFloor, RoundingCeil, RoundingHalfUp:
+		return RoundingMode(s), nil
+	}
+	return "", fmt.Errorf("unsupported tax rounding mode: %s", s)
+}
+
+// num/den を端数処理する(num, denは0以上)
+func (m RoundingMode) divide(num, den int64) int64 {
+	switch m {
+	case RoundingCeil:
+		return (num + den - 1) / den
+	case RoundingHalfUp:
+		return (2*num + den) / (2 * den)
+	default:
+		return num / den
+	}
+}
+
+type Calculator struct {
+	Rounding RoundingMode
+}
+
+func NewCalculator(rounding RoundingMode) *Calculator {
+	return &Calculator{Rounding: rounding}
+}
+
+// 税抜金額にかかる消費税(外税)。rateは%。通貨の最小単位で端数処理する
+func (c *Calculator) TaxExclusive(amountWithoutTax model.Money, rate int64) model.Money {
+	return model.NewMoney(c.Rounding.divide(amountWithoutTax.Amount*rate, 100), amountWithoutTax.Currency)
+}
+
+// 税込金額を税抜金額と消費税に分ける(内税)。rateは%
+func (c *Calculator) SplitInclusive(amount model.Money, rate int64) (amountWithoutTax, tax model.Money) {
+	tax = model.NewMoney(c.Rounding.divide(amount.Amount*rate, 100+rate), amount.Currency)
+	return model.NewMoney(amount.Amount-tax.Amount, amount.Currency), tax
+}
+
+// 明細からcurrencyの税抜合計・消費税・税込合計を計算する。
+// 消費税は税率ごとに税抜小計を合算してから1回だけ端数処理する(インボイス制度の計算方法)。
+// 明細にcurrency以外の通貨が混ざっていればmodel.CurrencyMismatchErrorを返す
+func (c *Calculator) Totals(currency model.Currency, items []model.OrderItem) (amount, amountWithoutTax, tax model.Money, err error) {
+	amountWithoutTax = model.NewMoney(0, currency)
+	tax = model.NewMoney(0, currency)
+
+	subtotalByRate := make(map[int64]model.Money)
+	for _, item := range items {
+		subtotal, ok := subtotalByRate[item.TaxRate]
+		if !ok {
+			subtotal = model.NewMoney(0, currency)
+		}
+		if subtotalByRate[item.TaxRate], err = subtotal.Add(item.Subtotal()); err != nil {
+			return amount, amountWithoutTax, tax, err
+		}
+		amountWithoutTax, _ = amountWithoutTax.Add(item.Subtotal())
+	}
+
+	for rate, subtotal := range subtotalByRate {
+		tax, _ = tax.Add(c.TaxExclusive(subtotal, rate))
+	}
+	amount, _ = amountWithoutTax.Add(tax)
+	return amount, amountWithoutTax, tax, nil
+}
+
+// 注文の税込金額(Amount)を税率で税抜金額と消費税に分けて設定する。
+// クライアントが税抜金額・消費税を送ってきた場合は計算結果と一致しなければエラーにする
+func (c *Calculator) ApplyInclusive(order *model.Order, rate int64) error {
+	amountWithoutTax, tax := c.SplitInclusive(order.Amount, rate)
+	if err := checkSupplied(order, order.Amount, amountWithoutTax, tax); err != nil {
+		return err
+	}
+	order.AmountWithoutTax, order.Tax = amountWithoutTax, tax
+	return nil
+}
+
+// 明細から計算した金額を注文に設定する。
+// 明細の通貨が注文の通貨と異なる場合や、クライアントが送ってきた金額が計算結果と一致しない場合はエラーにする
+func (c *Calculator) Apply(order *model.Order, items []model.OrderItem) error {
+	amount, amountWithoutTax, tax, err := c.Totals(order.Currency, items)
+	if err != nil {
+		return err
+	}
+	if err := checkSupplied(order, amount, amountWithoutTax, tax); err != nil {
+		return err
+	}
+	order.Amount, order.AmountWithoutTax, order.Tax = amount, amountWithoutTax, tax
+	return nil
+}
+
+// MismatchError クライアントが送ってきた金額が計算結果と一致しない
+type MismatchError struct {
+	Field    string // amount / amount_without_tax / tax
+	Supplied int64  // 通貨の最小単位
+	Expected int64
+}
+
+func (e *MismatchError) Error() string {
+	return fmt.Sprintf("%s %d does not match the calculated value (expected %d)", e.Field, e.Supplied, e.Expected)
+}
+
+// 送られてきた(0以外の)金額が計算結果と一致するか
+func checkSupplied(order *model.Order, amount, amountWithoutTax, tax model.Money) error {
+	if order.Amount.Amount != 0 && order.Amount.Amount != amount.Amount {
+		return &MismatchError{Field: "amount", Supplied: order.Amount.Amount, Expected: amount.Amount}
+	}
+	if order.AmountWithoutTax.Amount != 0 && order.AmountWithoutTax.Amount != amountWithoutTax.Amount {
+		return &MismatchError{Field: "amount_without_tax", Supplied: order.AmountWithoutTax.Amount, Expected: amountWithoutTax.Amount}
+	}
+	if order.Tax.Amount != 0 && order.Tax.Amount != tax.Amount {
+		return &MismatchError{Field: "tax", Supplied: order.Tax.Amount, Expected: tax.Amount}
+	}
+	return nil
+}
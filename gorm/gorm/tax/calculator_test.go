@@ -0,0 +1,212 @@
+package tax
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/makoto-developer/golang_examples/gorm/gorm/model"
+)
+
+func yen(n int64) model.Money {
+	return model.NewMoney(n, "JPY")
+}
+
+func item(unitPrice, quantity, rate int64) model.OrderItem {
+	return model.OrderItem{Quantity: quantity, Currency: "JPY", UnitPrice: yen(unitPrice), TaxRate: rate}
+}
+
+func TestParseRoundingMode(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    RoundingMode
+		wantErr bool
+	}{
+		{"", RoundingFloor, false},
+		{"floor", RoundingFloor, false},
+		{"ceil", RoundingCeil, false},
+		{"half_up", RoundingHalfUp, false},
+		{"round", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseRoundingMode(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseRoundingMode(%q) = %q, %v; want %q (error: %t)", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestDivide(t *testing.T) {
+	tests := []struct {
+		num, den            int64
+		floor, ceil, halfUp int64
+	}{
+		{0, 7, 0, 0, 0},
+		{20, 10, 2, 2, 2},
+		{14, 10, 1, 2, 1},
+		{15, 10, 1, 2, 2},
+		{19, 10, 1, 2, 2},
+		{10, 3, 3, 4, 3},
+	}
+	for _, tt := range tests {
+		for mode, want := range map[RoundingMode]int64{RoundingFloor: tt.floor, RoundingCeil: tt.ceil, RoundingHalfUp: tt.halfUp} {
+			if got := mode.divide(tt.num, tt.den); got != want {
+				t.Errorf("%s.divide(%d, %d) = %d, want %d", mode, tt.num, tt.den, got, want)
+			}
+		}
+	}
+}
+
+func TestTaxExclusive(t *testing.T) {
+	tests := []struct {
+		name             string
+		rounding         RoundingMode
+		amountWithoutTax int64
+		rate             int64
+		want             int64
+	}{
+		{"floor 8%", RoundingFloor, 999, 8, 79}, // 79.92
+		{"ceil 8%", RoundingCeil, 999, 8, 80},
+		{"half_up 8%", RoundingHalfUp, 999, 8, 80},
+		{"floor 10% half", RoundingFloor, 1005, 10, 100}, // 100.5
+		{"ceil 10% half", RoundingCeil, 1005, 10, 101},
+		{"half_up 10% half", RoundingHalfUp, 1005, 10, 101},
+		{"exact", RoundingCeil, 1000, 10, 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NewCalculator(tt.rounding).TaxExclusive(yen(tt.amountWithoutTax), tt.rate)
+			if got != yen(tt.want) {
+				t.Errorf("TaxExclusive(%d, %d) = %v, want %d", tt.amountWithoutTax, tt.rate, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitInclusive(t *testing.T) {
+	tests := []struct {
+		name                    string
+		rounding                RoundingMode
+		amount, rate            int64
+		wantWithoutTax, wantTax int64
+	}{
+		{"exact 10%", RoundingFloor, 1100, 10, 1000, 100},
+		{"floor 8%", RoundingFloor, 1000, 8, 926, 74}, // 74.07
+		{"ceil 8%", RoundingCeil, 1000, 8, 925, 75},
+		{"half_up 8%", RoundingHalfUp, 1000, 8, 926, 74},
+		{"floor 10%", RoundingFloor, 1000, 10, 910, 90}, // 90.90
+		{"ceil 10%", RoundingCeil, 1000, 10, 909, 91},
+		{"half_up 10%", RoundingHalfUp, 1000, 10, 909, 91},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withoutTax, tax := NewCalculator(tt.rounding).SplitInclusive(yen(tt.amount), tt.rate)
+			if withoutTax != yen(tt.wantWithoutTax) || tax != yen(tt.wantTax) {
+				t.Errorf("SplitInclusive(%d, %d) = (%v, %v), want (%d, %d)", tt.amount, tt.rate, withoutTax, tax, tt.wantWithoutTax, tt.wantTax)
+			}
+		})
+	}
+}
+
+func TestTotals(t *testing.T) {
+	// 8%の明細は1行ずつ端数処理すると8円×3=24円だが、税率ごとに合算して315円×8%=25.2円にしてから端数処理する
+	mixed := []model.OrderItem{
+		item(105, 1, 8),
+		item(105, 1, 8),
+		item(105, 1, 8),
+		item(1005, 1, 10), // 100.5円
+	}
+	tests := []struct {
+		name                                string
+		rounding                            RoundingMode
+		items                               []model.OrderItem
+		wantAmount, wantWithoutTax, wantTax int64
+	}{
+		{"floor mixed", RoundingFloor, mixed, 1445, 1320, 125},
+		{"ceil mixed", RoundingCeil, mixed, 1447, 1320, 127},
+		{"half_up mixed", RoundingHalfUp, mixed, 1446, 1320, 126},
+		{"quantity", RoundingFloor, []model.OrderItem{item(333, 3, 8)}, 1078, 999, 79},
+		{"no items", RoundingFloor, nil, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			amount, withoutTax, tax, err := NewCalculator(tt.rounding).Totals("JPY", tt.items)
+			if err != nil {
+				t.Fatalf("Totals: %v", err)
+			}
+			if amount != yen(tt.wantAmount) || withoutTax != yen(tt.wantWithoutTax) || tax != yen(tt.wantTax) {
+				t.Errorf("Totals = (%v, %v, %v), want (%d, %d, %d)", amount, withoutTax, tax, tt.wantAmount, tt.wantWithoutTax, tt.wantTax)
+			}
+		})
+	}
+}
+
+func TestTotalsCurrencyMismatch(t *testing.T) {
+	items := []model.OrderItem{item(100, 1, 10), {Quantity: 1, Currency: "USD", UnitPrice: model.NewMoney(100, "USD"), TaxRate: 10}}
+	_, _, _, err := NewCalculator(RoundingFloor).Totals("JPY", items)
+	var mismatch *model.CurrencyMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("Totals error = %v, want CurrencyMismatchError", err)
+	}
+}
+
+func TestApply(t *testing.T) {
+	items := []model.OrderItem{item(105, 3, 8), item(1005, 1, 10)}
+	tests := []struct {
+		name                                            string
+		suppliedAmount, suppliedWithoutTax, suppliedTax int64
+		wantField                                       string // 空なら一致
+	}{
+		{"nothing supplied", 0, 0, 0, ""},
+		{"all match", 1445, 1320, 125, ""},
+		{"amount mismatch", 1444, 0, 0, "amount"},
+		{"amount_without_tax mismatch", 0, 1321, 0, "amount_without_tax"},
+		{"tax mismatch (per-line rounding)", 0, 0, 124, "tax"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := &model.Order{Currency: "JPY", Amount: yen(tt.suppliedAmount), AmountWithoutTax: yen(tt.suppliedWithoutTax), Tax: yen(tt.suppliedTax)}
+			err := NewCalculator(RoundingFloor).Apply(order, items)
+			checkMismatch(t, err, tt.wantField)
+			if tt.wantField == "" && (order.Amount != yen(1445) || order.AmountWithoutTax != yen(1320) || order.Tax != yen(125)) {
+				t.Errorf("order = (%v, %v, %v), want (1445, 1320, 125)", order.Amount, order.AmountWithoutTax, order.Tax)
+			}
+		})
+	}
+}
+
+func TestApplyInclusive(t *testing.T) {
+	tests := []struct {
+		name                            string
+		suppliedWithoutTax, suppliedTax int64
+		wantField                       string
+	}{
+		{"nothing supplied", 0, 0, ""},
+		{"all match", 926, 74, ""},
+		{"amount_without_tax mismatch", 925, 0, "amount_without_tax"},
+		{"tax mismatch", 0, 75, "tax"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := &model.Order{Currency: "JPY", Amount: yen(1000), AmountWithoutTax: yen(tt.suppliedWithoutTax), Tax: yen(tt.suppliedTax)}
+			err := NewCalculator(RoundingFloor).ApplyInclusive(order, 8)
+			checkMismatch(t, err, tt.wantField)
+			if tt.wantField == "" && (order.AmountWithoutTax != yen(926) || order.Tax != yen(74)) {
+				t.Errorf("order = (%v, %v), want (926, 74)", order.AmountWithoutTax, order.Tax)
+			}
+		})
+	}
+}
+
+func checkMismatch(t *testing.T, err error, wantField string) {
+	t.Helper()
+	if wantField == "" {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return
+	}
+	var mismatch *MismatchError
+	if !errors.As(err, &mismatch) || mismatch.Field != wantField {
+		t.Fatalf("error = %v, want MismatchError on %s", err, wantField)
+	}
+}
@@ -0,0 +1,103 @@
+package tracing
+
+import (
+	"errors"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+const spanKey = "tracing:span"
+
+var tracer = otel.Tracer("github.com/makoto-developer/golang_examples/gorm/gorm/tracing")
+
+// GORMPlugin SQLごとにスパンを作るGORMのプラグイン(db.Useで登録する)。
+// リクエストのスパンの子にするので、スパンの無いctx(outboxのrelayなど)のSQLは記録しない
+type GORMPlugin struct{}
+
+func (GORMPlugin) Name() string {
+	return "tracing"
+}
+
+// Initialize SQLを実行するGORMのコールバックの前後でスパンを開始・終了する
+func (GORMPlugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	hooks := []struct {
+		operation     string
+		before, after func(name string, fn func(*gorm.DB)) error
+	}{
+		{"create", cb.Create().Before("gorm:create").Register, cb.Create().After("gorm:create").Register},
+		{"query", cb.Query().Before("gorm:query").Register, cb.Query().After("gorm:query").Register},
+		{"update", cb.Update().Before("gorm:update").Register, cb.Update().After("gorm:update").Register},
+		{"delete", cb.Delete().Before("gorm:delete").Register, cb.Delete().After("gorm:delete").Register},
+		{"row", cb.Row().Before("gorm:row").Register, cb.Row().After("gorm:row").Register},
+		{"raw", cb.Raw().Before("gorm:raw").Register, cb.Raw().After("gorm:raw").Register},
+	}
+	for _, h := range hooks {
+		if err := h.before("tracing:before_"+h.operation, startSpan(h.operation)); err != nil {
+			return err
+		}
+		if err := h.after("tracing:after_"+h.operation, endSpan(h.operation)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func startSpan(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		ctx := db.Statement.Context
+		if !trace.SpanContextFromContext(ctx).IsValid() {
+			return
+		}
+		_, span := tracer.Start(ctx, "gorm."+operation,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(dbSystem(db), semconv.DBOperationName(operation)),
+		)
+		db.InstanceSet(spanKey, span)
+	}
+}
+
+func endSpan(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		v, ok := db.InstanceGet(spanKey)
+		if !ok {
+			return
+		}
+		span := v.(trace.Span)
+		defer span.End()
+
+		if table := db.Statement.Table; table != "" {
+			span.SetName(operation + " " + table)
+			span.SetAttributes(semconv.DBCollectionName(table))
+		}
+		span.SetAttributes(
+			semconv.DBQueryText(sanitizeSQL(db.Statement.SQL.String())),
+			attribute.Int("gorm.parameter_count", len(db.Statement.Vars)),
+		)
+		if operation == "query" {
+			span.SetAttributes(semconv.DBResponseReturnedRows(int(db.RowsAffected)))
+		} else {
+			span.SetAttributes(attribute.Int64("gorm.rows_affected", db.RowsAffected))
+		}
+
+		if db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound) {
+			span.RecordError(db.Error)
+			span.SetStatus(codes.Error, db.Error.Error())
+		}
+	}
+}
+
+func dbSystem(db *gorm.DB) attribute.KeyValue {
+	switch db.Dialector.Name() {
+	case "postgres":
+		return semconv.DBSystemNamePostgreSQL
+	case "sqlite":
+		return semconv.DBSystemNameSQLite
+	}
+	return semconv.DBSystemNameOtherSQL
+}
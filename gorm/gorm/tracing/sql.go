@@ -0,0 +1,28 @@
+package tracing
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// 文字列・数値のリテラル(プレースホルダの$1などは除く)
+var literalPattern = regexp.MustCompile(`'(?:[^']|'')*'|\$?\b\d+(?:\.\d+)?\b`)
+
+// 10個を超えるプレースホルダの並び(IN ($1,$2,...)など)
+var placeholderListPattern = regexp.MustCompile(`\((?:\s*(?:\$\d+|\?)\s*,){10,}\s*(?:\$\d+|\?)\s*\)`)
+
+// スパンに記録するSQLから値を取り除く。
+// GORMが組み立てたSQLの値はプレースホルダになっているが、Rawで書いたリテラルも?にする。
+// 長いINのリストは件数だけ残す
+func sanitizeSQL(sql string) string {
+	sql = literalPattern.ReplaceAllStringFunc(sql, func(s string) string {
+		if strings.HasPrefix(s, "$") {
+			return s
+		}
+		return "?"
+	})
+	return placeholderListPattern.ReplaceAllStringFunc(sql, func(s string) string {
+		return fmt.Sprintf("(?, ... %d values)", strings.Count(s, ",")+1)
+	})
+}
@@ -0,0 +1,90 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	gormConfig "github.com/makoto-developer/golang_examples/gorm/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+)
+
+// トレースの送信先(TRACING_EXPORTER)
+const (
+	ExporterNone   = "none"   // 送らない(デフォルト)
+	ExporterOTLP   = "otlp"   // OTLP/HTTP(送信先はOTEL_EXPORTER_OTLP_ENDPOINTなどの環境変数)
+	ExporterStdout = "stdout" // 標準出力
+	ExporterFile   = "file"   // TRACING_FILEにJSONで追記する
+)
+
+// Setup W3C Trace Context(traceparent)を受け取れるようにし、送信先を指定した場合はトレースを送る。
+// 返した関数で送っていないスパンを送り出してから終了する
+func Setup(ctx context.Context, cfg gormConfig.TracingConfig) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var closeFile func() error
+	switch cfg.Exporter {
+	case ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterOTLP:
+		e, err := otlptracehttp.New(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+		}
+		exporter = e
+	case ExporterStdout:
+		e, err := stdouttrace.New(stdouttrace.WithPrettyPrint())
+		if err != nil {
+			return nil, err
+		}
+		exporter = e
+	case ExporterFile:
+		f, err := os.OpenFile(cfg.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open trace file: %w", err)
+		}
+		e, err := stdouttrace.New(stdouttrace.WithWriter(f))
+		if err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+		exporter, closeFile = e, f.Close
+	default:
+		return nil, fmt.Errorf("unsupported TRACING_EXPORTER: %s (use none, otlp, stdout or file)", cfg.Exporter)
+	}
+
+	// OTEL_RESOURCE_ATTRIBUTES・OTEL_SERVICE_NAMEがあればそちらを優先する
+	res, err := resource.New(ctx,
+		resource.WithTelemetrySDK(),
+		resource.WithAttributes(semconv.ServiceName(cfg.ServiceName)),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		// 呼び出し元がサンプリングしたリクエストは必ず記録する
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if closeFile != nil {
+			if cerr := closeFile(); err == nil {
+				err = cerr
+			}
+		}
+		return err
+	}, nil
+}
@@ -1,90 +1,445 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	_ "time/tzdata" // コンテナなどタイムゾーンのデータが無い環境でもAsia/Tokyoを使えるようにする
 
+	"github.com/getkin/kin-openapi/openapi3"
 	"github.com/gin-gonic/gin"
 	gormConfig "github.com/makoto-developer/golang_examples/gorm/config"
+	"github.com/makoto-developer/golang_examples/gorm/gorm/audit"
+	"github.com/makoto-developer/golang_examples/gorm/gorm/auth"
+	"github.com/makoto-developer/golang_examples/gorm/gorm/database"
 	"github.com/makoto-developer/golang_examples/gorm/gorm/handler"
+	"github.com/makoto-developer/golang_examples/gorm/gorm/metrics"
+	"github.com/makoto-developer/golang_examples/gorm/gorm/middleware"
+	"github.com/makoto-developer/golang_examples/gorm/gorm/model"
+	"github.com/makoto-developer/golang_examples/gorm/gorm/openapi"
+	"github.com/makoto-developer/golang_examples/gorm/gorm/outbox"
+	"github.com/makoto-developer/golang_examples/gorm/gorm/problem"
 	"github.com/makoto-developer/golang_examples/gorm/gorm/repository"
-	"gorm.io/driver/postgres"
+	"github.com/makoto-developer/golang_examples/gorm/gorm/tax"
+	"github.com/makoto-developer/golang_examples/gorm/gorm/tracing"
+	"github.com/makoto-developer/golang_examples/gorm/migration"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 )
 
 var (
-	db           *gorm.DB
-	orderRepo    repository.OrderRepository
-	orderHandler *handler.OrderHandler
-	config       *gormConfig.Config
+	db                  *gorm.DB
+	orderRepo           repository.OrderRepository
+	taxRateRepo         repository.TaxRateRepository
+	exchangeRateRepo    repository.ExchangeRateRepository
+	idemKeyRepo         repository.IdempotencyKeyRepository
+	orderEventRepo      repository.OrderEventRepository
+	reportRepo          repository.ReportRepository
+	orderHandler        *handler.OrderHandler
+	taxRateHandler      *handler.TaxRateHandler
+	exchangeRateHandler *handler.ExchangeRateHandler
+	orderEventHandler   *handler.OrderEventHandler
+	reportHandler       *handler.ReportHandler
+	healthHandler       *handler.HealthHandler
+	openAPIHandler      *handler.OpenAPIHandler
+	apiDoc              *openapi3.T
+	config              *gormConfig.Config
 )
 
 func initDB() {
-	dsn := fmt.Sprintf(
-		"host=%s user=%s password=%s dbname=%s port=%s sslmode=%s",
-		config.Database.Host,
-		config.Database.User,
-		config.Database.Password,
-		config.Database.DBName,
-		config.Database.Port,
-		config.Database.SSLMode,
-	)
-
 	var err error
-	db, err = gorm.Open(postgres.Open(dsn), &gorm.Config{
+	db, err = database.Open(config.Database, &gorm.Config{
 		Logger: logger.Default.LogMode(logger.Info),
 	})
 	if err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
 
-	log.Println("Database connected successfully")
+	log.Printf("Database connected successfully (%s, %d read replica(s))", config.Database.Driver, len(config.Database.ReplicaDSNs))
+}
+
+// クエリと接続プールのメトリクスを登録する(サーバを起動するときだけ)
+func initMetrics() {
+	if err := db.Use(metrics.GORMPlugin{}); err != nil {
+		log.Fatalf("Failed to register query metrics: %v", err)
+	}
+	pools, err := database.Pools(db)
+	if err == nil {
+		err = metrics.RegisterDBStats(pools)
+	}
+	if err != nil {
+		log.Fatalf("Failed to register connection pool metrics: %v", err)
+	}
+}
+
+// migrateサブコマンド用(DBが必要なコマンドのときだけ接続する)
+func openDB() *gorm.DB {
+	initDB()
+	return primaryDB()
 }
 
 func initRepository() {
 	orderRepo = repository.NewOrderRepository(db)
+	taxRateRepo = repository.NewTaxRateRepository(db)
+	exchangeRateRepo = repository.NewExchangeRateRepository(db)
+	idemKeyRepo = repository.NewIdempotencyKeyRepository(db)
+	orderEventRepo = repository.NewOrderEventRepository(db)
+	reportRepo = repository.NewReportRepository(db)
 	log.Println("Repository initialized successfully")
 }
 
 func initHandler() {
-	orderHandler = handler.NewOrderHandler(orderRepo)
+	rounding, err := tax.ParseRoundingMode(config.Tax.Rounding)
+	if err != nil {
+		log.Fatalf("Invalid TAX_ROUNDING: %v", err)
+	}
+	orderHandler = handler.NewOrderHandler(orderRepo, taxRateRepo, tax.NewCalculator(rounding), config.Server.BatchMaxOrders)
+	taxRateHandler = handler.NewTaxRateHandler(taxRateRepo)
+	exchangeRateHandler = handler.NewExchangeRateHandler(exchangeRateRepo)
+	orderEventHandler = handler.NewOrderEventHandler(orderEventRepo)
+	location, err := time.LoadLocation(config.Report.TimeZone)
+	if err != nil {
+		log.Fatalf("Invalid REPORT_TIMEZONE: %v", err)
+	}
+	var reportCurrency model.Currency
+	if config.Report.Currency != "" {
+		if reportCurrency, err = model.ParseCurrency(config.Report.Currency); err != nil {
+			log.Fatalf("Invalid REPORT_CURRENCY: %v", err)
+		}
+	}
+	reportHandler = handler.NewReportHandler(reportRepo, location, reportCurrency)
+	var migrator *migration.Migrator
+	if usesSQLMigrations() {
+		if migrator, err = migration.NewMigrator(primaryDB()); err != nil {
+			log.Fatalf("Failed to load migrations: %v", err)
+		}
+	}
+	healthHandler = handler.NewHealthHandler(db, migrator, config.Server.ReadyTimeout)
 	log.Println("Handler initialized successfully")
 }
 
+// 仕様書を読み込む(サーバを起動するときだけ)
+func initOpenAPI() {
+	var err error
+	if apiDoc, err = openapi.Load(); err != nil {
+		log.Fatalf("Failed to load OpenAPI spec: %v", err)
+	}
+	if openAPIHandler, err = handler.NewOpenAPIHandler(apiDoc); err != nil {
+		log.Fatalf("Failed to load OpenAPI spec: %v", err)
+	}
+}
+
 func init() {
 	config = gormConfig.LoadConfig()
+}
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if !usesSQLMigrations() {
+			log.Fatalf("migrate: DB_DRIVER=%s creates tables automatically at startup", config.Database.Driver)
+		}
+		if err := migration.Run(openDB, os.Args[2:]); err != nil {
+			log.Fatalf("migrate: %v", err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		initDB()
+		initRepository()
+		initHandler()
+		if err := importOrders(os.Args[2:]); err != nil {
+			log.Fatalf("import: %v", err)
+		}
+		return
+	}
+
 	initDB()
+	initMetrics()
 	initRepository()
 	initHandler()
-}
+	initOpenAPI()
+
+	if config.Database.RequireMigrated && usesSQLMigrations() {
+		checkMigrations()
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), config.Tracing)
+	if err != nil {
+		log.Fatalf("Failed to set up tracing: %v", err)
+	}
+	if err := db.Use(tracing.GORMPlugin{}); err != nil {
+		log.Fatalf("Failed to register query tracing: %v", err)
+	}
+
+	// relayと定期削除はサーバを止めてから止める(処理中のリクエストが書いたメッセージも送る)
+	background, stopBackground := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Go(func() { purgeExpiredIdempotencyKeys(background, time.Hour) })
+	startOutboxRelay(background, &wg)
 
-func main() {
 	r := gin.Default()
+	r.Use(
+		middleware.Tracing(config.Tracing.ServiceName),
+		middleware.RequestID(),
+		middleware.ReadPrimary(),
+		middleware.Metrics(),
+		middleware.Problem(),
+	)
+	r.NoRoute(func(c *gin.Context) {
+		_ = c.Error(problem.NotFound("route not found"))
+	})
 	setupRoutes(r)
-	err := r.Run(":" + config.Server.Port)
+	if err := openapi.CheckRoutes(apiDoc, r.Routes()); err != nil {
+		log.Fatalf("Failed to set up routes: %v", err)
+	}
+
+	srv := &http.Server{
+		Addr:    ":" + config.Server.Port,
+		Handler: escapeColonRoutes(r, "/orders:batch"),
+	}
+	if err := serve(srv); err != nil {
+		log.Printf("Server error: %v", err)
+	}
+
+	stopBackground()
+	wg.Wait()
+	flushTraces(shutdownTracing)
+	closeDB()
+}
+
+// 送っていないスパンを送り出す(送信先に繋がらない場合でも終了が止まらないよう期限を付ける)
+func flushTraces(shutdown func(context.Context) error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := shutdown(ctx); err != nil {
+		log.Printf("Failed to flush traces: %v", err)
+	}
+}
+
+// SIGINT/SIGTERMを受けるまでリクエストを処理する。
+// 受けたら新しい接続を受け付けるのをやめ、処理中のリクエストが終わるまで(最大SHUTDOWN_TIMEOUT)待つ
+func serve(srv *http.Server) error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	errCh := make(chan error, 1)
+	go func() {
+		log.Printf("Listening on %s", srv.Addr)
+		errCh <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+	// 2回目のシグナルではすぐに終了する
+	stop()
+	log.Printf("Shutting down server (waiting up to %s for in-flight requests)", config.Server.ShutdownTimeout)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), config.Server.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		// 時間内に終わらなかったリクエストは接続を切る
+		_ = srv.Close()
+		return fmt.Errorf("graceful shutdown did not complete: %w", err)
+	}
+	log.Println("Server stopped")
+	return nil
+}
+
+// ginは"\\:"でエスケープしたルートをRunの中でしか"/orders:batch"に直さないので、
+// http.Serverで起動する場合はリクエストのパスをエスケープした形にしてから渡す
+func escapeColonRoutes(h http.Handler, paths ...string) http.Handler {
+	escaped := make(map[string]string, len(paths))
+	for _, p := range paths {
+		escaped[p] = strings.ReplaceAll(p, ":", "\\:")
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if p, ok := escaped[req.URL.Path]; ok {
+			req.URL.Path = p
+			req.URL.RawPath = ""
+		}
+		h.ServeHTTP(w, req)
+	})
+}
+
+// マイグレーションの状態はレプリカの遅延に関係なくプライマリで確認する
+func primaryDB() *gorm.DB {
+	return db.WithContext(database.WithPrimary(context.Background()))
+}
+
+// DBの接続プール(リードレプリカを含む)を閉じる
+func closeDB() {
+	if err := database.Close(db); err != nil {
+		log.Printf("Failed to close database: %v", err)
+		return
+	}
+	log.Println("Database connection closed")
+}
+
+// スキーマをmigration/sqlのSQLで管理するドライバか
+func usesSQLMigrations() bool {
+	driver, err := database.Lookup(config.Database.Driver)
+	return err == nil && driver.SQLMigrations
+}
+
+// 未適用のマイグレーションがあれば起動しない
+func checkMigrations() {
+	m, err := migration.NewMigrator(primaryDB())
+	if err != nil {
+		log.Fatalf("Failed to load migrations: %v", err)
+	}
+	pending, err := m.Pending()
+	if err != nil {
+		log.Fatalf("Failed to check migrations: %v", err)
+	}
+	if len(pending) > 0 {
+		log.Fatalf("%d pending migration(s) (first: %d_%s). Run `go run main.go migrate up`", len(pending), pending[0].Version, pending[0].Name)
+	}
+}
+
+// CSVファイルの注文を取り込む(POST /orders/importと同じ)
+func importOrders(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "validate only, do not save")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: import [-dry-run] <file.csv>")
+	}
+
+	f, err := os.Open(fs.Arg(0))
 	if err != nil {
-		_ = fmt.Errorf("failed to start server: %v", err)
+		return err
+	}
+	defer f.Close()
+
+	ctx := database.WithPrimary(audit.WithActor(context.Background(), "import"))
+	result, err := orderHandler.Import(ctx, f, *dryRun)
+	if err != nil {
+		return err
+	}
+	for _, e := range result.Errors {
+		log.Printf("line %d: %s", e.Line, e.Error)
+	}
+	log.Printf("%d row(s), %d valid, %d imported (dry-run: %t)", result.Total, result.Valid, result.Imported, result.DryRun)
+	if len(result.Errors) > 0 {
+		return fmt.Errorf("%d row(s) failed", len(result.Errors))
+	}
+	return nil
+}
+
+// outboxのメッセージをRabbitMQに送るrelayを起動する(RABBITMQ_URLが空なら起動しない)
+func startOutboxRelay(ctx context.Context, wg *sync.WaitGroup) {
+	if config.Outbox.RabbitMQURL == "" {
+		log.Println("RABBITMQ_URL is not set. Outbox relay is disabled")
 		return
 	}
+	relay := outbox.NewRelay(repository.NewOutboxRepository(db), outbox.Config{
+		URL:          config.Outbox.RabbitMQURL,
+		Exchange:     config.Outbox.Exchange,
+		PollInterval: config.Outbox.PollInterval,
+		BatchSize:    config.Outbox.BatchSize,
+	})
+	wg.Go(func() { relay.Run(ctx) })
+}
+
+// 期限切れのIdempotency-Keyを定期的に削除する(ctxがキャンセルされるまで)
+func purgeExpiredIdempotencyKeys(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		n, err := idemKeyRepo.DeleteExpired(ctx, time.Now())
+		if err != nil {
+			log.Printf("Failed to purge idempotency keys: %v", err)
+			continue
+		}
+		if n > 0 {
+			log.Printf("Purged %d expired idempotency key(s)", n)
+		}
+	}
 }
 
 func setupRoutes(r *gin.Engine) {
 	r.GET("/ping", healthCheck)
+	// ヘルスチェックにはタイムアウトのミドルウェアを付けない(readyzは自分で期限を設定する)
+	r.GET("/healthz", healthHandler.Healthz)
+	r.GET("/readyz", healthHandler.Readyz)
+	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	r.GET("/openapi.json", openAPIHandler.Spec)
+	r.GET("/docs/*filepath", openAPIHandler.Docs)
+
+	// 注文と集計のルートはjwt-authのアクセストークンが必要(管理者以外は自分の注文だけ)
+	verifier, err := auth.NewVerifier(config.Auth.JWTSecret)
+	if err != nil {
+		log.Fatalf("JWT_SECRET is required (use the same value as jwt-auth): %v", err)
+	}
+	authenticate := middleware.Authenticate(verifier)
+
+	// 注文と集計のルートはハンドラの前に仕様書(gorm/openapi/openapi.yaml)で検証する
+	validate, err := middleware.ValidateRequest(apiDoc)
+	if err != nil {
+		log.Fatalf("Failed to set up request validation: %v", err)
+	}
+
+	// ルートごとの処理時間の上限(期限を過ぎたクエリは中断して504を返す)
+	timeout := middleware.Timeout(config.Server.RequestTimeout)
+	bulkTimeout := middleware.Timeout(config.Server.BulkTimeout)
+	exportTimeout := middleware.Timeout(config.Server.ExportTimeout)
+	reportTimeout := middleware.Timeout(config.Server.ReportTimeout)
+
+	// POST /orders:batch (":"はパスパラメータの記号なのでエスケープする)
+	r.POST("/orders\\:batch", authenticate, validate, bulkTimeout, orderHandler.BatchOrders)
+
+	orders := r.Group("/orders", authenticate, validate)
+	{
+		orders.GET("", timeout, orderHandler.GetOrders)
+		orders.GET("/export", exportTimeout, orderHandler.ExportOrders)
+		orders.POST("/import", middleware.RequireAdmin(), bulkTimeout, orderHandler.ImportOrders)
+		orders.GET("/:id", timeout, orderHandler.GetOrder)
+		orders.POST("", timeout, middleware.Idempotency(idemKeyRepo, config.Idempotency.KeyTTL), orderHandler.CreateOrder)
+		orders.PUT("/:id", timeout, orderHandler.UpdateOrder)
+		orders.DELETE("/:id", timeout, orderHandler.DeleteOrder)
+		orders.POST("/:id/restore", timeout, orderHandler.RestoreOrder)
+		orders.GET("/:id/history", timeout, orderEventHandler.GetOrderHistory)
+		// 支払い・発送・返金は管理者だけ、キャンセルは注文したユーザーもできる
+		orders.POST("/:id/pay", middleware.RequireAdmin(), timeout, orderHandler.PayOrder)
+		orders.POST("/:id/ship", middleware.RequireAdmin(), timeout, orderHandler.ShipOrder)
+		orders.POST("/:id/cancel", timeout, orderHandler.CancelOrder)
+		orders.GET("/:id/transitions", timeout, orderHandler.GetStatusTransitions)
+		orders.POST("/:id/refunds", middleware.RequireAdmin(), timeout, orderHandler.CreateRefund)
+		orders.GET("/:id/refunds", timeout, orderHandler.GetRefunds)
+	}
+
+	r.GET("/tax_rates", timeout, taxRateHandler.GetTaxRates)
+	r.GET("/exchange_rates", timeout, exchangeRateHandler.GetExchangeRates)
 
-	orders := r.Group("/orders")
+	reports := r.Group("/reports", authenticate, middleware.RequireAdmin(), validate)
 	{
-		orders.GET("", orderHandler.GetOrders)
-		orders.GET("/:id", orderHandler.GetOrder)
-		orders.POST("", orderHandler.CreateOrder)
-		orders.PUT("/:id", orderHandler.UpdateOrder)
-		orders.DELETE("/:id", orderHandler.DeleteOrder)
+		reports.GET("/sales", reportTimeout, reportHandler.GetSalesReport)
 	}
 
-	users := r.Group("/users")
+	users := r.Group("/users", authenticate, validate)
 	{
-		users.GET("/:user_id/orders", orderHandler.GetOrdersByUserID)
+		users.GET("/:user_id/orders", timeout, orderHandler.GetOrdersByUserID)
+		users.GET("/:user_id/orders/export", exportTimeout, orderHandler.ExportOrdersByUserID)
 	}
 }
 
@@ -0,0 +1,115 @@
+package migration
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+
+	"gorm.io/gorm"
+)
+
+// create で新しいファイルを作るディレクトリ(プロジェクトルートから実行する前提)
+const SourceDir = "migration/sql"
+
+const usage = "usage: migrate up|down|status|create <name>"
+
+var namePattern = regexp.MustCompile(`^\w+$`)
+
+// Run migrateサブコマンドを実行する。
+// createはファイルを作るだけなのでDBに接続しない(openはcreate以外のときだけ呼ぶ)
+func Run(open func() *gorm.DB, args []string) error {
+	if len(args) == 0 {
+		return errors.New(usage)
+	}
+
+	if args[0] == "create" {
+		if len(args) != 2 {
+			return errors.New("usage: migrate create <name>")
+		}
+		up, down, err := Create(SourceDir, args[1])
+		if err != nil {
+			return err
+		}
+		log.Printf("Created %s", up)
+		log.Printf("Created %s", down)
+		return nil
+	}
+
+	m, err := NewMigrator(open())
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := m.Up()
+		for _, mig := range applied {
+			log.Printf("Applied %d_%s", mig.Version, mig.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			log.Println("No pending migrations")
+		}
+	case "down":
+		mig, err := m.Down()
+		if err != nil {
+			return err
+		}
+		if mig == nil {
+			log.Println("No applied migrations")
+			return nil
+		}
+		log.Printf("Rolled back %d_%s", mig.Version, mig.Name)
+	case "status":
+		statuses, err := m.Status()
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			state := "pending"
+			if s.AppliedAt != nil {
+				state = "applied at " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%-40s %s\n", s.Version, s.Name, state)
+		}
+	default:
+		return errors.New(usage)
+	}
+	return nil
+}
+
+// Create 次のバージョン番号で空のup/downファイルを作成する
+func Create(dir, name string) (string, string, error) {
+	if !namePattern.MatchString(name) {
+		return "", "", fmt.Errorf("migration name must be [A-Za-z0-9_]: %s", name)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read %s: %w", dir, err)
+	}
+	var latest int64
+	for _, entry := range entries {
+		if m := fileNamePattern.FindStringSubmatch(entry.Name()); m != nil {
+			if v, _ := strconv.ParseInt(m[1], 10, 64); v > latest {
+				latest = v
+			}
+		}
+	}
+
+	base := fmt.Sprintf("%04d_%s", latest+1, name)
+	up := filepath.Join(dir, base+".up.sql")
+	down := filepath.Join(dir, base+".down.sql")
+	for _, p := range []string{up, down} {
+		if err := os.WriteFile(p, []byte("-- "+filepath.Base(p)+"\n"), 0o644); err != nil {
+			return "", "", fmt.Errorf("failed to create %s: %w", p, err)
+		}
+	}
+	return up, down, nil
+}
@@ -0,0 +1,232 @@
+package migration
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// マイグレーションのSQLファイル(<version>_<name>.up.sql / <version>_<name>.down.sql)
+//
+//go:embed sql/*.sql
+var files embed.FS
+
+const sqlDir = "sql"
+
+var fileNamePattern = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// 適用済みのバージョン
+type appliedMigration struct {
+	Version   int64     `gorm:"primaryKey;column:version"`
+	Name      string    `gorm:"column:name"`
+	AppliedAt time.Time `gorm:"column:applied_at"`
+}
+
+func (appliedMigration) TableName() string {
+	return "schema_migrations"
+}
+
+type Status struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+type Migrator struct {
+	db         *gorm.DB
+	migrations []Migration
+}
+
+func NewMigrator(db *gorm.DB) (*Migrator, error) {
+	migrations, err := load(files)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// WithContext ctxでクエリを実行するMigratorを返す(読み込んだSQLファイルは共有する)
+func (m *Migrator) WithContext(ctx context.Context) *Migrator {
+	return &Migrator{db: m.db.WithContext(ctx), migrations: m.migrations}
+}
+
+// 埋め込んだSQLファイルをバージョン順に読み込む
+func load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, sqlDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		m := fileNamePattern.FindStringSubmatch(entry.Name())
+		if m == nil {
+			return nil, fmt.Errorf("invalid migration file name: %s", entry.Name())
+		}
+		version, _ := strconv.ParseInt(m[1], 10, 64)
+		body, err := fs.ReadFile(fsys, path.Join(sqlDir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", entry.Name(), err)
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		}
+		if mig.Name != m[2] {
+			return nil, fmt.Errorf("migration version %d has different names: %s, %s", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.Up = string(body)
+		} else {
+			mig.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", mig.Version, mig.Name)
+		}
+		migrations = append(migrations, *mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// バージョン管理用のテーブルを作成する
+func (m *Migrator) ensureTable() error {
+	err := m.db.Exec(`create table if not exists schema_migrations
+(
+    version    bigint    not null primary key,
+    name       text      not null,
+    applied_at timestamp not null
+)`).Error
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+	return nil
+}
+
+// バージョン管理用のテーブルを作成してから、適用済みのバージョンを読む(up/down/status用)
+func (m *Migrator) applied() (map[int64]appliedMigration, error) {
+	if err := m.ensureTable(); err != nil {
+		return nil, err
+	}
+	return m.readApplied()
+}
+
+// 適用済みのバージョンを読むだけ(DDLは実行しない)。テーブルが無ければ何も適用していないものとする
+func (m *Migrator) readApplied() (map[int64]appliedMigration, error) {
+	if !m.db.Migrator().HasTable(&appliedMigration{}) {
+		return map[int64]appliedMigration{}, nil
+	}
+	var rows []appliedMigration
+	if err := m.db.Order("version").Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	applied := make(map[int64]appliedMigration, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+// 全マイグレーションの適用状況
+func (m *Migrator) Status() ([]Status, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		s := Status{Migration: mig}
+		if row, ok := applied[mig.Version]; ok {
+			s.AppliedAt = &row.AppliedAt
+		}
+		statuses = append(statuses, s)
+	}
+	return statuses, nil
+}
+
+// 未適用のマイグレーション。読み込みだけなので/readyzから何度呼んでもよい
+func (m *Migrator) Pending() ([]Migration, error) {
+	applied, err := m.readApplied()
+	if err != nil {
+		return nil, err
+	}
+	var pending []Migration
+	for _, mig := range m.migrations {
+		if _, ok := applied[mig.Version]; !ok {
+			pending = append(pending, mig)
+		}
+	}
+	return pending, nil
+}
+
+// 未適用のマイグレーションを古い順に全て適用する。1つずつトランザクションで実行する
+func (m *Migrator) Up() ([]Migration, error) {
+	if err := m.ensureTable(); err != nil {
+		return nil, err
+	}
+	pending, err := m.Pending()
+	if err != nil {
+		return nil, err
+	}
+	for i, mig := range pending {
+		err := m.db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec(mig.Up).Error; err != nil {
+				return err
+			}
+			return tx.Create(&appliedMigration{Version: mig.Version, Name: mig.Name, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return pending[:i], fmt.Errorf("failed to apply migration %d_%s: %w", mig.Version, mig.Name, err)
+		}
+	}
+	return pending, nil
+}
+
+// 最後に適用したマイグレーションを1つ戻す。適用済みのものが無ければnilを返す
+func (m *Migrator) Down() (*Migration, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := len(m.migrations) - 1; i >= 0; i-- {
+		mig := m.migrations[i]
+		if _, ok := applied[mig.Version]; !ok {
+			continue
+		}
+		if mig.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s has no down file", mig.Version, mig.Name)
+		}
+		err := m.db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec(mig.Down).Error; err != nil {
+				return err
+			}
+			return tx.Delete(&appliedMigration{}, mig.Version).Error
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to roll back migration %d_%s: %w", mig.Version, mig.Name, err)
+		}
+		return &mig, nil
+	}
+	return nil, nil
+}
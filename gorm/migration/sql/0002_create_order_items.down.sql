@@ -0,0 +1,3 @@
+drop table if exists order_items;
+
+drop table if exists order_item_groups;
@@ -0,0 +1,40 @@
+create table if not exists order_item_groups
+(
+    id         bigserial
+        constraint order_item_groups_pk
+            primary key,
+    created_at timestamp default CURRENT_TIMESTAMP
+);
+
+comment on table order_item_groups is '注文明細グループ(1回の注文に含まれる明細のまとまり)';
+
+create table if not exists order_items
+(
+    id                  bigserial
+        constraint order_items_pk
+            primary key,
+    order_item_group_id bigint   not null
+        constraint order_items_order_item_groups_id_fk
+            references order_item_groups,
+    product_id          bigint   not null,
+    quantity            bigint   not null,
+    unit_price          bigint   not null,
+    tax_rate_id         smallint not null,
+    tax_rate            bigint   not null,
+    created_at          timestamp default CURRENT_TIMESTAMP
+);
+
+comment on table order_items is '注文明細';
+
+comment on column order_items.product_id is '商品ID';
+
+comment on column order_items.quantity is '数量';
+
+comment on column order_items.unit_price is '税抜単価';
+
+comment on column order_items.tax_rate_id is '消費税率ID';
+
+comment on column order_items.tax_rate is '作成時点の消費税率(%)';
+
+create index if not exists order_items_order_item_group_id_index
+    on order_items (order_item_group_id);
@@ -0,0 +1,36 @@
+create table if not exists tax_rates
+(
+    id             smallserial
+        constraint tax_rates_pk
+            primary key,
+    code           text      not null,
+    name           text      not null,
+    rate           bigint    not null,
+    effective_from timestamp not null,
+    effective_to   timestamp
+);
+
+comment on table tax_rates is '消費税率';
+
+comment on column tax_rates.code is '税率の種類(standard: 標準税率, reduced: 軽減税率)';
+
+comment on column tax_rates.rate is '税率(%)';
+
+comment on column tax_rates.effective_from is '適用開始日時(この日時を含む)';
+
+comment on column tax_rates.effective_to is '適用終了日時(この日時を含まない/NULLは現在も有効)';
+
+create index if not exists tax_rates_code_effective_from_index
+    on tax_rates (code, effective_from);
+
+-- マイグレーション導入前に手動でテーブルを作った環境に重複して登録しないよう、空のときだけ登録する
+-- 税率は日本時間の0時に切り替わったので、UTCの日時(前日の15時)にして登録する
+insert into tax_rates (code, name, rate, effective_from, effective_to)
+select *
+from (values ('standard', '標準税率', 5, '1997-04-01T00:00:00+09:00'::timestamptz at time zone 'UTC',
+              '2014-04-01T00:00:00+09:00'::timestamptz at time zone 'UTC'),
+             ('standard', '標準税率', 8, '2014-04-01T00:00:00+09:00'::timestamptz at time zone 'UTC',
+              '2019-10-01T00:00:00+09:00'::timestamptz at time zone 'UTC'),
+             ('standard', '標準税率', 10, '2019-10-01T00:00:00+09:00'::timestamptz at time zone 'UTC', null::timestamp),
+             ('reduced', '軽減税率', 8, '2019-10-01T00:00:00+09:00'::timestamptz at time zone 'UTC', null::timestamp)) as v
+where not exists(select 1 from tax_rates);
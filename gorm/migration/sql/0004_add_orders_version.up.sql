@@ -0,0 +1,4 @@
+alter table orders
+    add column if not exists version bigint not null default 1;
+
+comment on column orders.version is '楽観的排他制御のバージョン(更新のたびに1増える)';
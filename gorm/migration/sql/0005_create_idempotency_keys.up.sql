@@ -0,0 +1,22 @@
+create table if not exists idempotency_keys
+(
+    key           text      not null
+        constraint idempotency_keys_pk
+            primary key,
+    fingerprint   text      not null,
+    status_code   integer   not null default 0,
+    response_body bytea,
+    created_at    timestamp not null default CURRENT_TIMESTAMP,
+    expires_at    timestamp not null
+);
+
+comment on table idempotency_keys is 'Idempotency-Keyヘッダーと、そのリクエストで返したレスポンス';
+
+comment on column idempotency_keys.fingerprint is 'リクエスト(メソッド・パス・ボディ)のSHA-256';
+
+comment on column idempotency_keys.status_code is '返したHTTPステータス(0は処理中)';
+
+comment on column idempotency_keys.expires_at is '有効期限(これを過ぎたキーは再利用できる)';
+
+create index if not exists idempotency_keys_expires_at_index
+    on idempotency_keys (expires_at);
@@ -0,0 +1,31 @@
+create table if not exists order_events
+(
+    id         bigserial
+        constraint order_events_pk
+            primary key,
+    order_id   bigint    not null,
+    event_type text      not null,
+    actor      text      not null,
+    request_id text      not null default '',
+    before     jsonb,
+    after      jsonb,
+    changes    jsonb,
+    created_at timestamp not null default CURRENT_TIMESTAMP
+);
+
+comment on table order_events is '注文の変更履歴(監査用)';
+
+comment on column order_events.event_type is '変更の種類(created/updated/deleted/restored)';
+
+comment on column order_events.actor is '変更した人';
+
+comment on column order_events.request_id is '変更したリクエストのX-Request-ID';
+
+comment on column order_events.before is '変更前の注文';
+
+comment on column order_events.after is '変更後の注文';
+
+comment on column order_events.changes is '変更された項目ごとの変更前後の値';
+
+create index if not exists order_events_order_id_id_index
+    on order_events (order_id, id);
@@ -0,0 +1,29 @@
+create table if not exists outbox
+(
+    id             bigserial
+        constraint outbox_pk
+            primary key,
+    aggregate_type text      not null,
+    aggregate_id   bigint    not null,
+    message_type   text      not null,
+    payload        jsonb     not null,
+    attempts       integer   not null default 0,
+    last_error     text      not null default '',
+    created_at     timestamp not null default CURRENT_TIMESTAMP,
+    claimed_until  timestamp,
+    sent_at        timestamp
+);
+
+comment on table outbox is 'RabbitMQに送るメッセージ(トランザクショナルアウトボックス)';
+
+comment on column outbox.message_type is 'メッセージの種類(OrderCreated/OrderUpdated/OrderDeleted/OrderRestored)';
+
+comment on column outbox.attempts is '送信に失敗した回数';
+
+comment on column outbox.claimed_until is 'relayが送信中として確保した期限(この日時までは他のrelayが送らない)';
+
+comment on column outbox.sent_at is '送信した日時(NULLは未送信)';
+
+create index if not exists outbox_unsent_id_index
+    on outbox (id)
+    where sent_at is null;
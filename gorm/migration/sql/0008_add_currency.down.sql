@@ -0,0 +1,7 @@
+comment on column order_items.unit_price is '税抜単価';
+
+alter table order_items
+    drop column if exists currency;
+
+alter table orders
+    drop column if exists currency;
@@ -0,0 +1,11 @@
+alter table orders
+    add column if not exists currency char(3) not null default 'JPY';
+
+comment on column orders.currency is '通貨(ISO 4217)。amount/amount_without_tax/taxはこの通貨の最小単位';
+
+alter table order_items
+    add column if not exists currency char(3) not null default 'JPY';
+
+comment on column order_items.currency is '通貨(ISO 4217)。unit_priceはこの通貨の最小単位';
+
+comment on column order_items.unit_price is '税抜単価(通貨の最小単位)';
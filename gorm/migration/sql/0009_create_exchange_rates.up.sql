@@ -0,0 +1,24 @@
+create table if not exists exchange_rates
+(
+    id             bigserial
+        constraint exchange_rates_pk
+            primary key,
+    base_currency  char(3)         not null,
+    quote_currency char(3)         not null,
+    rate           numeric(20, 10) not null
+        constraint exchange_rates_rate_check
+            check (rate > 0),
+    effective_from timestamp       not null,
+    effective_to   timestamp
+);
+
+comment on table exchange_rates is '為替レート(集計の換算用)';
+
+comment on column exchange_rates.rate is '1 base_currency あたりの quote_currency の金額';
+
+comment on column exchange_rates.effective_from is '適用開始日時(この日時を含む)';
+
+comment on column exchange_rates.effective_to is '適用終了日時(この日時を含まない/NULLは現在も有効)';
+
+create index if not exists exchange_rates_currencies_effective_from_index
+    on exchange_rates (base_currency, quote_currency, effective_from);
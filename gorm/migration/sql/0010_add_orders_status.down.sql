@@ -0,0 +1,6 @@
+drop table if exists order_status_transitions;
+
+drop index if exists orders_status_index;
+
+alter table orders
+    drop column if exists status;
@@ -0,0 +1,44 @@
+-- 状態を導入する前の注文は支払い済みとして扱う(売上の集計から外れないようにする)。
+-- 既存の行を埋めてから、新しく作る注文のデフォルトをpendingにする
+alter table orders
+    add column if not exists status text;
+
+update orders
+set status = 'paid'
+where status is null;
+
+alter table orders
+    alter column status set default 'pending',
+    alter column status set not null,
+    add constraint orders_status_check
+        check (status in ('pending', 'paid', 'shipped', 'cancelled', 'refunded'));
+
+comment on column orders.status is '状態(pending: 支払い待ち, paid: 支払い済み, shipped: 発送済み, cancelled: キャンセル, refunded: 返金済み)';
+
+create index if not exists orders_status_index
+    on orders (status);
+
+create table if not exists order_status_transitions
+(
+    id          bigserial
+        constraint order_status_transitions_pk
+            primary key,
+    order_id    bigint    not null,
+    from_status text      not null,
+    to_status   text      not null,
+    reason      text      not null default '',
+    actor       text      not null,
+    request_id  text      not null default '',
+    created_at  timestamp not null default CURRENT_TIMESTAMP
+);
+
+comment on table order_status_transitions is '注文の状態遷移の記録';
+
+comment on column order_status_transitions.reason is '遷移の理由';
+
+comment on column order_status_transitions.actor is '遷移させた人';
+
+comment on column order_status_transitions.request_id is '遷移させたリクエストのX-Request-ID';
+
+create index if not exists order_status_transitions_order_id_id_index
+    on order_status_transitions (order_id, id);
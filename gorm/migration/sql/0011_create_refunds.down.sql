@@ -0,0 +1,7 @@
+drop table if exists refunds;
+
+alter table orders
+    drop column if exists refunded_tax;
+
+alter table orders
+    drop column if exists refunded_amount;
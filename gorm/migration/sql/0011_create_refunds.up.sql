@@ -0,0 +1,41 @@
+alter table orders
+    add column if not exists refunded_amount bigint not null default 0;
+
+alter table orders
+    add column if not exists refunded_tax bigint not null default 0;
+
+comment on column orders.refunded_amount is '返金済みの金額(税込、currencyの最小単位)。返金を差し引いた金額はamount - refunded_amount';
+
+comment on column orders.refunded_tax is '返金済みの金額のうち消費税';
+
+create table if not exists refunds
+(
+    id         bigserial
+        constraint refunds_pk
+            primary key,
+    order_id   bigint    not null,
+    currency   char(3)   not null default 'JPY',
+    amount     bigint    not null
+        constraint refunds_amount_check
+            check (amount > 0),
+    tax        bigint    not null default 0
+        constraint refunds_tax_check
+            check (tax >= 0 and tax <= amount),
+    reason     text      not null default '',
+    created_by text      not null,
+    request_id text      not null default '',
+    created_at timestamp not null default CURRENT_TIMESTAMP
+);
+
+comment on table refunds is '注文の返金(一部の返金を含む)';
+
+comment on column refunds.amount is '返金額(税込、currencyの最小単位)';
+
+comment on column refunds.tax is '返金額のうち消費税';
+
+comment on column refunds.created_by is '返金した人';
+
+comment on column refunds.request_id is '返金したリクエストのX-Request-ID';
+
+create index if not exists refunds_order_id_id_index
+    on refunds (order_id, id);
@@ -106,6 +106,7 @@ func Login(c *gin.Context) {
 		UserID:   user.ID,
 		Email:    user.Email,
 		Username: user.Username,
+		Role:     util.RoleFor(user.Email),
 	}
 
 	accessToken, err := util.GenerateAccessToken(claims)
@@ -145,7 +146,7 @@ func Refresh(c *gin.Context) {
 	}
 
 	// リフレッシュトークン検証
-	claims, err := util.ValidateToken(req.RefreshToken)
+	claims, err := util.ValidateToken(req.RefreshToken, util.TokenTypeRefresh)
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{
 			"error": "Invalid or expired refresh token",
@@ -158,6 +159,7 @@ func Refresh(c *gin.Context) {
 		UserID:   claims.UserID,
 		Email:    claims.Email,
 		Username: claims.Username,
+		Role:     util.RoleFor(claims.Email),
 	}
 
 	accessToken, err := util.GenerateAccessToken(newClaims)
@@ -15,4 +15,5 @@ type Claims struct {
 	UserID   uint   `json:"user_id"`
 	Email    string `json:"email"`
 	Username string `json:"username"`
+	Role     string `json:"role,omitempty"`
 }
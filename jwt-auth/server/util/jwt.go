@@ -4,6 +4,7 @@ import (
 	"errors"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -15,10 +16,21 @@ var (
 	ErrExpiredToken = errors.New("token has expired")
 )
 
+// トークンの種類。他のサービスはアクセストークンだけを受け付ける
+const (
+	TokenTypeAccess  = "access"
+	TokenTypeRefresh = "refresh"
+)
+
+// 管理者のロール(全ユーザーのデータを扱える)
+const RoleAdmin = "admin"
+
 type JWTClaims struct {
-	UserID   uint   `json:"user_id"`
-	Email    string `json:"email"`
-	Username string `json:"username"`
+	UserID    uint   `json:"user_id"`
+	Email     string `json:"email"`
+	Username  string `json:"username"`
+	Role      string `json:"role,omitempty"`
+	TokenType string `json:"token_type"`
 	jwt.RegisteredClaims
 }
 
@@ -57,13 +69,25 @@ func GetRefreshExpires() int64 {
 	return exp
 }
 
+// RoleFor メールアドレスのユーザーのロールを取得（ADMIN_EMAILSに含まれていれば管理者）
+func RoleFor(email string) string {
+	for _, admin := range strings.Split(os.Getenv("ADMIN_EMAILS"), ",") {
+		if admin = strings.TrimSpace(admin); admin != "" && strings.EqualFold(admin, email) {
+			return RoleAdmin
+		}
+	}
+	return ""
+}
+
 // GenerateAccessToken アクセストークンを生成
 func GenerateAccessToken(claims model.Claims) (string, error) {
 	expiresIn := GetAccessExpires()
 	jwtClaims := JWTClaims{
-		UserID:   claims.UserID,
-		Email:    claims.Email,
-		Username: claims.Username,
+		UserID:    claims.UserID,
+		Email:     claims.Email,
+		Username:  claims.Username,
+		Role:      claims.Role,
+		TokenType: TokenTypeAccess,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Duration(expiresIn) * time.Second)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -78,9 +102,11 @@ func GenerateAccessToken(claims model.Claims) (string, error) {
 func GenerateRefreshToken(claims model.Claims) (string, error) {
 	expiresIn := GetRefreshExpires()
 	jwtClaims := JWTClaims{
-		UserID:   claims.UserID,
-		Email:    claims.Email,
-		Username: claims.Username,
+		UserID:    claims.UserID,
+		Email:     claims.Email,
+		Username:  claims.Username,
+		Role:      claims.Role,
+		TokenType: TokenTypeRefresh,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Duration(expiresIn) * time.Second)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -91,8 +117,8 @@ func GenerateRefreshToken(claims model.Claims) (string, error) {
 	return token.SignedString(GetJWTSecret())
 }
 
-// ValidateToken トークンを検証
-func ValidateToken(tokenString string) (*JWTClaims, error) {
+// ValidateToken トークンを検証（tokenTypeと種類が違うトークンは無効にする）
+func ValidateToken(tokenString string, tokenType string) (*JWTClaims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, ErrInvalidToken
@@ -105,7 +131,7 @@ func ValidateToken(tokenString string) (*JWTClaims, error) {
 	}
 
 	claims, ok := token.Claims.(*JWTClaims)
-	if !ok || !token.Valid {
+	if !ok || !token.Valid || claims.TokenType != tokenType {
 		return nil, ErrInvalidToken
 	}
 
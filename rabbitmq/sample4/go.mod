@@ -0,0 +1,5 @@
+module github.com/makoto-developer/golang_examples/rabbitmq
+
+go 1.25.1
+
+require github.com/rabbitmq/amqp091-go v1.10.0